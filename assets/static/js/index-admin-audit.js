@@ -0,0 +1,57 @@
+var loadAdminAudits = (function ($) {
+    var i18n = {};
+
+    /**
+     * load admin action audit trail
+     * @param lang {{}} language json
+     * @param title page title
+     */
+    function loadAdminAudits(lang, title) {
+        i18n = lang;
+        $("#title").text(title);
+        $('#content').html(layui.laytpl($('#adminAuditTemplate').html()).render());
+        layui.form.render(null, 'adminAuditSearchForm');
+        layui.laydate.render({elem: '#adminAuditStart', type: 'datetime'});
+        layui.laydate.render({elem: '#adminAuditEnd', type: 'datetime'});
+
+        var $section = $('#content > section');
+        layui.table.render({
+            elem: '#adminAuditTable',
+            height: $section.height() - $('#adminAuditSearchForm').height() + 8,
+            text: {none: i18n['EmptyData']},
+            url: '/api/admin_audits',
+            method: 'get',
+            where: {},
+            dataType: 'json',
+            page: pageOptions,
+            cols: [[
+                {field: 'time', title: i18n['Time'], width: 170},
+                {field: 'actor', title: i18n['Actor'], width: 120},
+                {field: 'action', title: i18n['Action'], width: 200},
+                {field: 'target', title: i18n['Target'], width: 160},
+                {field: 'source_ip', title: i18n['SourceIP'], width: 140},
+                {field: 'payload', title: i18n['Payload']}
+            ]]
+        });
+
+        $('#adminAuditSearchBtn').on('click', function () {
+            layui.table.reload('adminAuditTable', {
+                where: layui.form.val('adminAuditSearchForm'),
+                page: {curr: 1}
+            });
+            return false;
+        });
+        $('#adminAuditResetBtn').on('click', function () {
+            $('#adminAuditSearchForm')[0].reset();
+            layui.form.render(null, 'adminAuditSearchForm');
+            layui.table.reload('adminAuditTable', {where: layui.form.val('adminAuditSearchForm'), page: {curr: 1}});
+            return false;
+        });
+        $('#adminAuditExportBtn').on('click', function () {
+            window.open('/api/admin_audits/export?' + $.param(layui.form.val('adminAuditSearchForm')));
+            return false;
+        });
+    }
+
+    return loadAdminAudits;
+})(layui.$);
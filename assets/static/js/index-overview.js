@@ -0,0 +1,124 @@
+var loadOverview = (function ($) {
+    var size = filesize.partial({base: 2, standard: "jedec"});
+    var i18n = {};
+
+    /**
+     * load overview of every frps server
+     * @param lang {{}} language json
+     * @param title page title
+     */
+    function loadOverview(lang, title) {
+        i18n = lang;
+        $("#title").text(title);
+        $('#content').html(layui.laytpl($('#overviewTemplate').html()).render());
+        layui.form.render(null, 'overviewProxyForm');
+
+        var loading = layui.layer.load();
+        $.getJSON('/api/overview').done(function (result) {
+            if (!result.success) {
+                layui.layer.msg(result.message);
+                return;
+            }
+            var total = result.total;
+            var rows = result.servers.slice();
+            rows.push({
+                name: i18n['All'],
+                reachable: true,
+                summary: true,
+                version: total.reachable + ' / ' + total.servers,
+                client_counts: total.client_counts,
+                cur_conns: total.cur_conns,
+                proxy_counts: total.proxy_counts,
+                traffic_in: total.traffic_in,
+                traffic_out: total.traffic_out
+            });
+            renderServerTable(rows);
+        }).always(function () {
+            layui.layer.close(loading);
+        });
+
+        renderProxyTable('tcp');
+        layui.form.on('select(overviewProxyType)', function (data) {
+            renderProxyTable(data.value);
+        });
+    }
+
+    function renderServerTable(rows) {
+        layui.table.render({
+            elem: '#overviewServerTable',
+            text: {none: i18n['EmptyData']},
+            data: rows,
+            limit: rows.length,
+            cols: [[
+                {field: 'name', title: i18n['Server'], width: 140},
+                {
+                    field: 'reachable', title: i18n['Status'], width: 200,
+                    templet: function (d) {
+                        if (d.summary) return '';
+                        if (d.reachable) return i18n['Reachable'] + ' (' + d.latency_ms + 'ms)';
+                        return '<span style="color: #FF5722;" title="' + layui.util.escape(d.error || '') + '">' + i18n['Unreachable'] + '</span>';
+                    }
+                },
+                {field: 'version', title: i18n['Version'], width: 100},
+                {field: 'client_counts', title: i18n['ClientCounts']},
+                {field: 'cur_conns', title: i18n['CurrentConnections']},
+                {field: 'proxy_counts', title: i18n['ProxyCounts']},
+                {
+                    field: 'traffic_in', title: i18n['TrafficIn'],
+                    templet: function (d) {
+                        return size(d.traffic_in || 0);
+                    }
+                },
+                {
+                    field: 'traffic_out', title: i18n['TrafficOut'],
+                    templet: function (d) {
+                        return size(d.traffic_out || 0);
+                    }
+                }
+            ]]
+        });
+    }
+
+    function renderProxyTable(proxyType) {
+        layui.table.render({
+            elem: '#overviewProxyTable',
+            text: {none: i18n['EmptyData']},
+            url: '/api/overview/proxies',
+            method: 'get',
+            where: {type: proxyType},
+            page: pageOptions,
+            cols: [[
+                {field: 'server', title: i18n['Server'], width: 120},
+                {field: 'name', title: i18n['Name']},
+                {
+                    field: 'status', title: i18n['Status'], width: 100,
+                    templet: function (d) {
+                        return i18n[d.status] || d.status;
+                    }
+                },
+                {field: 'curConns', title: i18n['Connections'], width: 100},
+                {
+                    field: 'todayTrafficIn', title: i18n['TrafficIn'], width: 120,
+                    templet: function (d) {
+                        return size(d.todayTrafficIn);
+                    }
+                },
+                {
+                    field: 'todayTrafficOut', title: i18n['TrafficOut'], width: 120,
+                    templet: function (d) {
+                        return size(d.todayTrafficOut);
+                    }
+                },
+                {field: 'clientVersion', title: i18n['ClientVersion'], width: 120}
+            ]],
+            done: function (res) {
+                var failed = Object.keys(res.errors || {});
+                if (failed.length > 0) {
+                    layui.layer.msg(i18n['Unreachable'] + ': ' + failed.join(', '));
+                }
+            }
+        });
+    }
+
+    return loadOverview;
+})(layui.$);
@@ -0,0 +1,60 @@
+var loadPluginLogs = (function ($) {
+    var i18n = {};
+
+    /**
+     * load plugin decision logs
+     * @param lang {{}} language json
+     * @param title page title
+     */
+    function loadPluginLogs(lang, title) {
+        i18n = lang;
+        $("#title").text(title);
+        $('#content').html(layui.laytpl($('#pluginLogTemplate').html()).render());
+        layui.form.render(null, 'pluginLogSearchForm');
+        layui.laydate.render({elem: '#pluginLogStart', type: 'datetime'});
+        layui.laydate.render({elem: '#pluginLogEnd', type: 'datetime'});
+
+        var $section = $('#content > section');
+        layui.table.render({
+            elem: '#pluginLogTable',
+            height: $section.height() - $('#pluginLogSearchForm').height() + 8,
+            text: {none: i18n['EmptyData']},
+            url: '/api/plugin_logs',
+            method: 'get',
+            where: {},
+            dataType: 'json',
+            page: pageOptions,
+            cols: [[
+                {field: 'time', title: i18n['Time'], width: 170},
+                {field: 'op', title: i18n['Op'], width: 120},
+                {field: 'user', title: i18n['User'], width: 120},
+                {field: 'server', title: i18n['Server'], width: 120},
+                {field: 'proxy_name', title: i18n['ProxyName'], width: 160},
+                {field: 'client_addr', title: i18n['ClientAddress'], width: 160},
+                {
+                    field: 'reject', title: i18n['Result'], width: 90,
+                    templet: function (d) {
+                        return d.reject ? '<span style="color: #FF5722;">' + i18n['Rejected'] + '</span>' : i18n['Accepted'];
+                    }
+                },
+                {field: 'reason', title: i18n['Reason']}
+            ]]
+        });
+
+        $('#pluginLogSearchBtn').on('click', function () {
+            layui.table.reload('pluginLogTable', {
+                where: layui.form.val('pluginLogSearchForm'),
+                page: {curr: 1}
+            });
+            return false;
+        });
+        $('#pluginLogResetBtn').on('click', function () {
+            $('#pluginLogSearchForm')[0].reset();
+            layui.form.render(null, 'pluginLogSearchForm');
+            layui.table.reload('pluginLogTable', {where: layui.form.val('pluginLogSearchForm'), page: {curr: 1}});
+            return false;
+        });
+    }
+
+    return loadPluginLogs;
+})(layui.$);
@@ -15,17 +15,26 @@ var loadProxyInfo = (function ($) {
         var loading = layui.layer.load();
 
         $.getJSON('/proxy/api/proxy/' + proxyType).done(function (result) {
-            if (result.success) {
-                $('#content').html($('#proxyListTableTemplate').html());
-                renderProxyListTable(JSON.parse(result.data)['proxies'], proxyType);
-            } else {
-                layui.layer.msg(result.message);
-            }
+            $('#content').html($('#proxyListTableTemplate').html());
+            renderProxyListTable(result.proxies || [], proxyType);
+        }).fail(function (xhr) {
+            layui.layer.msg(proxyErrorMessage(xhr));
         }).always(function () {
             layui.layer.close(loading);
         });
     }
 
+    /**
+     * error message of a failed dashboard request, frps returns plain text errors
+     * @param xhr jqXHR
+     */
+    function proxyErrorMessage(xhr) {
+        if (xhr.responseJSON && xhr.responseJSON.message) {
+            return xhr.responseJSON.message;
+        }
+        return xhr.status + ' ' + (xhr.responseText || xhr.statusText);
+    }
+
     /**
      * render proxy list table
      * @param data proxy data
@@ -152,12 +161,10 @@ var loadProxyInfo = (function ($) {
     function loadTrafficStatistics() {
         var proxyName = $(this).closest('.layui-row').find('input').val();
         var loading = layui.layer.load();
-        $.getJSON('/proxy/api/traffic/' + proxyName).done(function (result) {
-            if (result.success) {
-                renderTrafficChart(JSON.parse(result.data));
-            } else {
-                layui.layer.msg(result.message);
-            }
+        $.getJSON('/proxy/api/traffic/' + encodeURIComponent(proxyName)).done(function (result) {
+            renderTrafficChart(result);
+        }).fail(function (xhr) {
+            layui.layer.msg(proxyErrorMessage(xhr));
         }).always(function () {
             layui.layer.close(loading);
         });
@@ -13,31 +13,28 @@ var loadServerInfo = (function ($) {
         $('#content').empty();
         var loading = layui.layer.load();
 
-        $.getJSON('/proxy/api/serverinfo').done(function (result) {
-            if (result.success) {
-                var data = JSON.parse(result.data);
-                data.proxyCounts = 0;
-                httpPort = data.vhostHTTPPort;
-                httpsPort = data.vhostHTTPSPort;
-                for (var proxy in data.proxyTypeCount) {
-                    data.proxyCounts = data.proxyCounts + data.proxyTypeCount[proxy];
-                }
-                data.bindPort = data.bindPort || i18n['Disable'];
-                data.kcpBindPort = data.kcpBindPort || i18n['Disable'];
-                data.quicBindPort = data.quicBindPort || i18n['Disable'];
-                data.vhostHTTPPort = data.vhostHTTPPort || i18n['Disable'];
-                data.vhostHTTPSPort = data.vhostHTTPSPort || i18n['Disable'];
-                data.tcpmuxHTTPConnectPort = data.tcpmuxHTTPConnectPort || i18n['Disable'];
-                data.subdomainHost = data.subdomainHost || i18n['NotSet'];
-                data.maxPoolCount = data.maxPoolCount || i18n['NotSet'];
-                data.maxPortsPerClient = data.maxPortsPerClient || i18n['NotLimit'];
-                data.heartbeatTimeout = data.heartbeatTimeout || i18n['NotSet'];
-                data.allowPortsStr = data.allowPortsStr || i18n['NotLimit'];
-                data.tlsForce = i18n[data.tlsForce || false];
-                renderServerInfo(data);
-            } else {
-                layui.layer.msg(result.message);
+        $.getJSON('/proxy/api/serverinfo').done(function (data) {
+            data.proxyCounts = 0;
+            httpPort = data.vhostHTTPPort;
+            httpsPort = data.vhostHTTPSPort;
+            for (var proxy in data.proxyTypeCount) {
+                data.proxyCounts = data.proxyCounts + data.proxyTypeCount[proxy];
             }
+            data.bindPort = data.bindPort || i18n['Disable'];
+            data.kcpBindPort = data.kcpBindPort || i18n['Disable'];
+            data.quicBindPort = data.quicBindPort || i18n['Disable'];
+            data.vhostHTTPPort = data.vhostHTTPPort || i18n['Disable'];
+            data.vhostHTTPSPort = data.vhostHTTPSPort || i18n['Disable'];
+            data.tcpmuxHTTPConnectPort = data.tcpmuxHTTPConnectPort || i18n['Disable'];
+            data.subdomainHost = data.subdomainHost || i18n['NotSet'];
+            data.maxPoolCount = data.maxPoolCount || i18n['NotSet'];
+            data.maxPortsPerClient = data.maxPortsPerClient || i18n['NotLimit'];
+            data.heartbeatTimeout = data.heartbeatTimeout || i18n['NotSet'];
+            data.allowPortsStr = data.allowPortsStr || i18n['NotLimit'];
+            data.tlsForce = i18n[data.tlsForce || false];
+            renderServerInfo(data);
+        }).fail(function (xhr) {
+            layui.layer.msg(xhr.responseJSON && xhr.responseJSON.message || xhr.status + ' ' + (xhr.responseText || xhr.statusText));
         }).always(function () {
             layui.layer.close(loading);
         });
@@ -54,8 +51,164 @@ var loadServerInfo = (function ($) {
 
         renderTrafficChart(data);
         renderCountChart(data);
+        loadPluginPath();
     }
 
+    /**
+     * show the plugin path frps should register for the current dashboard
+     */
+    function loadPluginPath() {
+        $.getJSON('/dashboards').done(function (res) {
+            if (res.code !== 0 || !res.data || !res.data[res.current_index]) {
+                return;
+            }
+            var dashboard = res.data[res.current_index];
+            $('#rotatePluginKey').data('name', dashboard.name);
+            $('#editDashboard').data('dashboard', dashboard);
+            $('#pluginPath').text(dashboard.plugin_key ? '/handler/' + dashboard.plugin_key : i18n['NotSet']);
+            renderTlsVerify(dashboard.tls_verify);
+        });
+    }
+
+    /**
+     * show how the dashboard certificate is verified, insecure mode is flagged
+     * @param mode none, system, ca, pinned or insecure
+     */
+    function renderTlsVerify(mode) {
+        var texts = {
+            none: i18n['TlsVerifyNone'],
+            system: i18n['TlsVerifySystem'],
+            ca: i18n['TlsVerifyCa'],
+            pinned: i18n['TlsVerifyPinned'],
+            insecure: i18n['TlsVerifyInsecure']
+        };
+        var badge = $('<span class="layui-badge"></span>').text(texts[mode] || mode);
+        badge.addClass(mode === 'insecure' ? 'layui-bg-red' : mode === 'none' ? 'layui-bg-gray' : 'layui-bg-green');
+        $('#dashboardTls').empty().append(badge);
+    }
+
+    /**
+     * generate a new plugin key for the current dashboard
+     */
+    function rotatePluginKey() {
+        var name = $(this).data('name');
+        layui.layer.confirm(i18n['ConfirmRotatePluginKey'], {
+            title: i18n['OperationConfirm'],
+            btn: [i18n['Confirm'], i18n['Cancel']]
+        }, function (index) {
+            layui.layer.close(index);
+            $.ajax({
+                url: '/rotate_plugin_key',
+                type: 'post',
+                contentType: 'application/json',
+                data: JSON.stringify({name: name}),
+                success: function (result) {
+                    if (result.success) {
+                        $('#pluginPath').text(result.plugin_path);
+                        layui.layer.msg(i18n['OperateSuccess']);
+                    } else {
+                        layui.layer.msg(result.message);
+                    }
+                }
+            });
+        });
+    }
+
+    $(document).on('click.rotatePluginKey', '#rotatePluginKey', function () {
+        rotatePluginKey.call(this);
+    });
+
+    /**
+     * edit dashboard settings of the current server, credentials are write only
+     */
+    function editDashboard() {
+        var dashboard = $(this).data('dashboard');
+        if (!dashboard) {
+            return;
+        }
+        layui.layer.open({
+            type: 1,
+            title: i18n['EditDashboard'] + ' - ' + dashboard.name,
+            area: ['600px', '80%'],
+            content: layui.laytpl($('#dashboardTemplate').html()).render($.extend({}, dashboard, {
+                pwdPlaceholder: dashboard.dashboard_pwd_set ? i18n['SecretUnchanged'] : i18n['NotSet'],
+                keyPlaceholder: dashboard.dashboard_client_key_set ? i18n['SecretUnchanged'] : i18n['NotSet']
+            })),
+            success: function () {
+                layui.form.render(null, 'dashboardForm');
+            },
+            btn: [i18n['Confirm'], i18n['Cancel']],
+            btn1: function (index) {
+                var formData = layui.form.val('dashboardForm');
+                var data = {
+                    name: dashboard.name,
+                    dashboard_addr: formData.dashboard_addr,
+                    dashboard_port: parseInt(formData.dashboard_port, 10),
+                    dashboard_user: formData.dashboard_user,
+                    dashboard_tls: formData.dashboard_tls === 'on',
+                    dashboard_fingerprint: formData.dashboard_fingerprint,
+                    dashboard_ca_cert: formData.dashboard_ca_cert,
+                    dashboard_client_cert: formData.dashboard_client_cert,
+                    dashboard_insecure: formData.dashboard_insecure === 'on'
+                };
+                // 留空的凭据不提交, 保持不变
+                if (formData.dashboard_pwd !== '') {
+                    data.dashboard_pwd = formData.dashboard_pwd;
+                }
+                if (formData.dashboard_client_key.trim() !== '') {
+                    data.dashboard_client_key = formData.dashboard_client_key;
+                }
+                $.ajax({
+                    url: '/save_dashboard',
+                    type: 'post',
+                    contentType: 'application/json',
+                    data: JSON.stringify(data),
+                    success: function (result) {
+                        if (result.success) {
+                            layui.layer.close(index);
+                            layui.layer.msg(i18n['OperateSuccess']);
+                            loadPluginPath();
+                        } else {
+                            layui.layer.msg(result.message);
+                        }
+                    }
+                });
+            },
+            btn2: function (index) {
+                layui.layer.close(index);
+            }
+        });
+    }
+
+    $(document).on('click.editDashboard', '#editDashboard', function () {
+        editDashboard.call(this);
+    });
+
+    /**
+     * remove offline proxies from the current frps
+     */
+    function clearOfflineProxies() {
+        layui.layer.confirm(i18n['ConfirmClearOffline'], {
+            title: i18n['OperationConfirm'],
+            btn: [i18n['Confirm'], i18n['Cancel']]
+        }, function (index) {
+            layui.layer.close(index);
+            $.ajax({
+                url: '/clear_offline_proxies',
+                type: 'post',
+                contentType: 'application/json',
+                data: JSON.stringify({server: $('#rotatePluginKey').data('name') || ''}),
+                success: function (result) {
+                    layui.layer.msg(result.success ? i18n['OperateSuccess'] : result.message);
+                }
+            });
+        });
+    }
+
+    $(document).on('click.clearOfflineProxies', '#clearOfflineProxies', function () {
+        clearOfflineProxies.call(this);
+    });
+
     /**
      * render traffic chart with echarts
      * @param data traffic data
@@ -0,0 +1,115 @@
+var loadServerStatus = (function ($) {
+    var i18n = {};
+
+    /**
+     * load health status of every frps server
+     * @param lang {{}} language json
+     * @param title page title
+     */
+    function loadServerStatus(lang, title) {
+        i18n = lang;
+        $("#title").text(title);
+        $('#content').html(layui.laytpl($('#serverStatusTemplate').html()).render());
+
+        var loading = layui.layer.load();
+        $.getJSON('/api/server_status').done(function (result) {
+            if (!result.success) {
+                layui.layer.msg(result.message);
+                return;
+            }
+            renderStatusTable(result.data);
+        }).always(function () {
+            layui.layer.close(loading);
+        });
+
+        layui.table.on('tool(serverStatusTable)', function (obj) {
+            if (obj.event === 'history') {
+                historyPopup(obj.data.name);
+            }
+        });
+    }
+
+    function renderStatusTable(data) {
+        layui.table.render({
+            elem: '#serverStatusTable',
+            text: {none: i18n['EmptyData']},
+            data: data,
+            limit: data.length,
+            cols: [[
+                {
+                    field: 'name', title: i18n['Server'], width: 200,
+                    templet: function (d) {
+                        return '<img src="/api/server_status/badge/' + encodeURIComponent(d.name) + '?t=' + Date.now() + '" alt="' + layui.util.escape(d.name) + '"/>';
+                    }
+                },
+                {
+                    field: 'latency_ms', title: i18n['Latency'], width: 100,
+                    templet: function (d) {
+                        return d.up ? d.latency_ms + 'ms' : '-';
+                    }
+                },
+                {field: 'since', title: i18n['Since'], width: 170},
+                {field: 'checked_at', title: i18n['CheckedAt'], width: 170},
+                {field: 'uptime_24h', title: i18n['Uptime24h'], width: 110},
+                {field: 'uptime_7d', title: i18n['Uptime7d'], width: 110},
+                {field: 'uptime_30d', title: i18n['Uptime30d'], width: 110},
+                {field: 'error', title: i18n['Error']},
+                {title: i18n['Operation'], width: 90, toolbar: '#serverStatusOperationTemplate'}
+            ]]
+        });
+    }
+
+    function historyPopup(name) {
+        $.getJSON('/api/server_status/history', {server: name, days: 30}).done(function (result) {
+            if (!result.success) {
+                layui.layer.msg(result.message);
+                return;
+            }
+            layui.layer.open({
+                type: 1,
+                title: i18n['History'] + ' - ' + name,
+                area: ['800px', '600px'],
+                content: layui.laytpl($('#serverStatusHistoryTemplate').html()).render(),
+                success: function () {
+                    var days = [], uptime = [], latency = [];
+                    (result.daily || []).forEach(function (day) {
+                        days.push(day.day);
+                        uptime.push(day.total > 0 ? (day.up * 100 / day.total).toFixed(2) : 0);
+                        latency.push(Math.round(day.latency_ms));
+                    });
+                    echarts.init(document.getElementById('serverStatusHistoryChart')).setOption({
+                        tooltip: {trigger: 'axis'},
+                        legend: {data: [i18n['Uptime'], i18n['Latency']]},
+                        xAxis: {type: 'category', data: days},
+                        yAxis: [
+                            {type: 'value', min: 0, max: 100, axisLabel: {formatter: '{value}%'}},
+                            {type: 'value', axisLabel: {formatter: '{value}ms'}}
+                        ],
+                        series: [
+                            {name: i18n['Uptime'], type: 'line', data: uptime},
+                            {name: i18n['Latency'], type: 'bar', yAxisIndex: 1, data: latency}
+                        ]
+                    });
+                    layui.table.render({
+                        elem: '#serverStatusTransitionTable',
+                        text: {none: i18n['EmptyData']},
+                        data: result.transitions,
+                        page: pageOptions,
+                        cols: [[
+                            {field: 'time', title: i18n['Time'], width: 170},
+                            {
+                                field: 'up', title: i18n['Status'], width: 90,
+                                templet: function (d) {
+                                    return d.up ? i18n['Up'] : '<span style="color: #FF5722;">' + i18n['Down'] + '</span>';
+                                }
+                            },
+                            {field: 'error', title: i18n['Error']}
+                        ]]
+                    });
+                }
+            });
+        });
+    }
+
+    return loadServerStatus;
+})(layui.$);
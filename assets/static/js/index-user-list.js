@@ -53,6 +53,20 @@ var loadUserList = (function ($) {
                 {field: 'ports', title: i18n['AllowedPorts'], sort: true, edit: 'textarea'},
                 {field: 'domains', title: i18n['AllowedDomains'], sort: true, edit: 'textarea'},
                 {field: 'subdomains', title: i18n['AllowedSubdomains'], sort: true, edit: 'textarea'},
+                {field: 'bandwidth_upload', title: i18n['BandwidthUpload'], width: 110, edit: true},
+                {field: 'bandwidth_download', title: i18n['BandwidthDownload'], width: 110, edit: true},
+                {
+                    field: 'quota', title: i18n['Quota'], width: 160,
+                    templet: function (d) {
+                        return ui.formatQuota(d);
+                    }
+                },
+                {
+                    field: 'schedule', title: i18n['Schedule'], width: 160,
+                    templet: function (d) {
+                        return ui.formatSchedule(d.schedule);
+                    }
+                },
                 {
                     field: 'enable', title: i18n['Status'], width: 100,
                     templet: '<span>{{d.enable? "' + i18n['Enable'] + '":"' + i18n['Disable'] + '"}}</span>',
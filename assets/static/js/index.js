@@ -29,6 +29,14 @@ var httpPort, httpsPort, pageOptions;
                         loadServerInfo(lang, title.trim());
                     } else if (id === 'userList') {
                         loadUserList(lang, title.trim(), dashboardsData); // 传递 dashboardsData
+                    } else if (id === 'pluginLogs') {
+                        loadPluginLogs(lang, title.trim());
+                    } else if (id === 'overview') {
+                        loadOverview(lang, title.trim());
+                    } else if (id === 'serverStatus') {
+                        loadServerStatus(lang, title.trim());
+                    } else if (id === 'adminAudits') {
+                        loadAdminAudits(lang, title.trim());
                     } else if (elem.closest('.layui-nav-item').attr('id') === 'proxyList') {
                         if (id != null && id.trim() !== '') {
                             var suffix = elem.closest('.layui-nav-item').children('a').text().trim();
@@ -69,7 +77,9 @@ var httpPort, httpsPort, pageOptions;
                         $('#currentDashboardName').text(dashboardsData[currentIndex].name);
                         $.each(dashboardsData, function (index, dashboard) {
                             var activeClass = (index === currentIndex) ? 'layui-this' : '';
-                            dropdown.append('<dd class="' + activeClass + '"><a href="javascript:;" data-index="' + index + '">' + dashboard.name + '</a></dd>');
+                            // 未校验证书的服务器加上警告标记
+                            var insecure = dashboard.tls_verify === 'insecure' ? ' <span class="layui-badge-dot" title="' + lang['TlsVerifyInsecure'] + '"></span>' : '';
+                            dropdown.append('<dd class="' + activeClass + '"><a href="javascript:;" data-index="' + index + '">' + dashboard.name + insecure + '</a></dd>');
                         });
                         updateCurrentIndexCallback(currentIndex);
                         layui.element.render('nav', 'dashboardList');
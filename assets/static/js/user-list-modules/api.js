@@ -33,7 +33,7 @@
             if (/^\d+$/.test(String(port)) && typeof port === "string") after.ports[index] = parseInt(String(port));
         });
         var loading = layui.layer.load();
-        $.ajax({
+        return $.ajax({
             url: '/update', type: 'post', contentType: 'application/json',
             data: JSON.stringify({before: before, after: after}),
             success: function (result) {
@@ -70,7 +70,14 @@
                 if (result.success) {
                     ui.reloadTable();
                     layui.layer.close(index);
-                    layui.layer.msg(i18n['OperateSuccess'] + extendMessage, function (i) { layui.layer.close(i); });
+                    if (result.warnings && result.warnings.length > 0) {
+                        // 例如 frps 版本过低无法清理离线代理, 需要管理员手动处理
+                        layui.layer.alert(result.warnings.map(function (warning) {
+                            return $('<div>').text(warning).html();
+                        }).join('<br>'), {title: i18n['OperateSuccess'], icon: 0});
+                    } else {
+                        layui.layer.msg(i18n['OperateSuccess'] + extendMessage, function (i) { layui.layer.close(i); });
+                    }
                 } else {
                     ui.errorMsg(result);
                 }
@@ -136,13 +143,13 @@
     }
     exports.getAllMaxPorts = getAllMaxPorts;
 
-    function saveConfigTemplate(template) {
+    function saveConfigTemplate(server, template, comment) {
         return new Promise((resolve, reject) => {
             $.ajax({
                 url: '/save_config_template',
                 type: 'post',
                 contentType: 'application/json',
-                data: JSON.stringify({ template: template }),
+                data: JSON.stringify({ server: server, template: template, comment: comment }),
                 success: function (result) {
                     if (result.success) {
                         layui.layer.msg(i18n['OperateSuccess']);
@@ -161,4 +168,82 @@
     }
     exports.saveConfigTemplate = saveConfigTemplate;
 
+    function rollbackConfigTemplate(server, version) {
+        var loading = layui.layer.load();
+        return $.ajax({
+            url: '/rollback_config_template', type: 'post', contentType: 'application/json',
+            data: JSON.stringify({server: server, version: version}),
+            success: function (result) {
+                if (result.success) {
+                    layui.layer.msg(i18n['OperateSuccess']);
+                } else {
+                    ui.errorMsg(result);
+                }
+            },
+            complete: function () {
+                layui.layer.close(loading);
+            }
+        });
+    }
+    exports.rollbackConfigTemplate = rollbackConfigTemplate;
+
+    function topUpQuota(user, amount) {
+        var loading = layui.layer.load();
+        return $.ajax({
+            url: '/quota/topup', type: 'post', contentType: 'application/json',
+            data: JSON.stringify({user: user, amount: amount}),
+            success: function (result) {
+                if (result.success) {
+                    layui.layer.msg(i18n['OperateSuccess']);
+                } else {
+                    ui.errorMsg(result);
+                }
+            },
+            complete: function () {
+                layui.layer.close(loading);
+            }
+        });
+    }
+    exports.topUpQuota = topUpQuota;
+
+    /**
+     * close the current frpc sessions of a user
+     * @param user user name
+     */
+    function kickUser(user) {
+        var loading = layui.layer.load();
+        return $.ajax({
+            url: '/kick_user', type: 'post', contentType: 'application/json',
+            data: JSON.stringify({user: user}),
+            success: function (result) {
+                layui.layer.msg(result.success ? i18n['OperateSuccess'] : result.message);
+            },
+            complete: function () {
+                layui.layer.close(loading);
+            }
+        });
+    }
+
+    exports.kickUser = kickUser;
+
+    /**
+     * allow kicked frpc sessions of a user to log in again
+     * @param user user name
+     */
+    function unkickUser(user) {
+        var loading = layui.layer.load();
+        return $.ajax({
+            url: '/unkick_user', type: 'post', contentType: 'application/json',
+            data: JSON.stringify({user: user}),
+            success: function (result) {
+                layui.layer.msg(result.success ? i18n['OperateSuccess'] : result.message);
+            },
+            complete: function () {
+                layui.layer.close(loading);
+            }
+        });
+    }
+
+    exports.unkickUser = unkickUser;
+
 })(window.UserListAPI = window.UserListAPI || {}, layui.$);
@@ -10,7 +10,7 @@
         var before = $.extend(true, {}, obj.data), after = $.extend(true, {}, obj.data);
         var verifyMsg = false;
 
-        if (['token', 'comment', 'ports', 'domains', 'subdomains', 'expire_date'].includes(field)) {
+        if (['token', 'comment', 'ports', 'domains', 'subdomains', 'expire_date', 'bandwidth_upload', 'bandwidth_download'].includes(field)) {
             verifyMsg = validatorRules[field](value, function (trim) {
                 ui.updateTableField(obj, field, trim);
             });
@@ -78,6 +78,21 @@
             case 'exportConfig':
                 ui.exportConfig([data]);
                 break;
+            case 'schedule':
+                ui.schedulePopup(data);
+                break;
+            case 'servers':
+                ui.serversPopup(data);
+                break;
+            case 'policy':
+                ui.policyPopup(data);
+                break;
+            case 'quota':
+                ui.quotaPopup(data);
+                break;
+            case 'kick':
+                ui.kickPopup(data);
+                break;
             case 'disable':
                 ui.confirmPopup('ConfirmDisableUser', [data], api.type.Disable);
                 break;
@@ -5,32 +5,7 @@
     var api = null; // 将在主文件中注入
     var validatorRules = null; // 将在主文件中注入
     var dashboardsData = []; // 用于存储 dashboards 数据
-    var defaultConfigTemplate = ''; // 存储配置模板
     
-    // 加载配置模板
-    function loadConfigTemplate() {
-        $.ajax({
-            url: '../static/config_template.json',
-            type: 'GET',
-            dataType: 'json',
-            async: false, // 同步请求，确保在使用前加载完成
-            success: function(data) {
-                if (data && data.template) {
-                    defaultConfigTemplate = data.template;
-                } else {
-                    console.error('配置模板格式错误');
-                    // 设置一个默认值，以防加载失败
-                    defaultConfigTemplate = '#frpc 配置模板加载失败';
-                }
-            },
-            error: function(xhr, status, error) {
-                console.error('加载配置模板失败:', error);
-                // 设置一个默认值，以防加载失败
-                defaultConfigTemplate = '#frpc 配置模板加载失败';
-            }
-        });
-    }
-
     // 生成随机字符串的辅助函数
     function generateRandomString(length, characters) {
         var result = '';
@@ -49,9 +24,12 @@
         var codeMap = {
             1: 'ParamError', 2: 'UserExist', 3: 'UserNotExist', 4: 'ParamError',
             5: 'UserFormatError', 6: 'TokenFormatError', 7: 'CommentInvalid',
-            8: 'PortsInvalid', 9: 'DomainsInvalid', 10: 'SubdomainsInvalid'
+            8: 'PortsInvalid', 9: 'DomainsInvalid', 10: 'SubdomainsInvalid',
+            11: 'ExpireDateInvalid', 13: 'ScheduleInvalid', 14: 'ServersInvalid',
+            15: 'DomainsConflict', 16: 'SubdomainsReserved', 17: 'SubdomainsConflict',
+            19: 'PolicyInvalid', 20: 'BandwidthInvalid', 21: 'QuotaInvalid'
         };
-        var reason = i18n[codeMap[result.code]] || i18n['OtherError'];
+        var reason = i18n[codeMap[result.code]] || result.message || i18n['OtherError'];
         layui.layer.msg(i18n['OperateFailed'] + ',' + reason);
     }
 
@@ -213,100 +191,347 @@
     }
 
 
+    function escapeHtml(text) {
+        return $('<div>').text(text).html();
+    }
+
+    // 加载服务器当前的模板, 服务器没有单独的模板时显示默认模板
+    function loadConfigTemplateOf(server) {
+        $.getJSON('/api/config_template', {server: server}, function (result) {
+            if (!result.success) {
+                errorMsg(result);
+                return;
+            }
+            $('#configTemplateEditor').val(result.data.template);
+            $('#configTemplateInherit').toggle(result.data.inherit);
+            $('#configTemplateVersion').text(result.data.version ? 'v' + result.data.version : '');
+        });
+    }
+
     function editConfigTemplatePopup() {
+        var options = `<option value="">${ i18n['DefaultTemplate'] }</option>`;
+        dashboardsData.forEach(function (dashboard) {
+            options += `<option value="${ escapeHtml(dashboard.name) }">${ escapeHtml(dashboard.name) }</option>`;
+        });
         layui.layer.open({
             type: 1,
             title: i18n['ConfigTemplate'],
-            area: ['800px', '600px'],
-            content: `<form class="layui-form" style="padding: 20px;">
+            area: ['800px', '680px'],
+            content: `<form class="layui-form" lay-filter="configTemplateForm" style="padding: 20px;">
+                <div class="layui-form-item">
+                    <label class="layui-form-label">${ i18n['Server'] }</label>
+                    <div class="layui-input-inline">
+                        <select id="configTemplateServer" lay-filter="configTemplateServer">${ options }</select>
+                    </div>
+                    <div class="layui-form-mid" id="configTemplateVersion"></div>
+                </div>
                 <div class="layui-form-item layui-form-text">
                     <label class="layui-form-label">${ i18n['ConfigTemplate'] }</label>
                     <div class="layui-input-block">
+                        <div class="layui-form-mid layui-text-em" id="configTemplateInherit" style="display: none;">${ i18n['InheritTemplate'] }</div>
                         <textarea name="configTemplate" id="configTemplateEditor" placeholder="${ i18n['PleaseInputConfigTemplate'] }"
-                                  autocomplete="off" class="layui-textarea" style="height: 400px;">${ defaultConfigTemplate }</textarea>
+                                  autocomplete="off" class="layui-textarea" style="height: 360px;"></textarea>
+                        <div id="configTemplateError" style="display: none; margin-top: 5px; color: #ff5722;">
+                            <div id="configTemplateErrorMessage"></div>
+                            <details>
+                                <summary>${ i18n['SampleConfig'] }</summary>
+                                <pre id="configTemplateRendered" style="max-height: 200px; overflow: auto;"></pre>
+                            </details>
+                        </div>
+                    </div>
+                </div>
+                <div class="layui-form-item">
+                    <label class="layui-form-label">${ i18n['TemplateComment'] }</label>
+                    <div class="layui-input-block">
+                        <input type="text" id="configTemplateComment" autocomplete="off" class="layui-input">
                     </div>
                 </div>
             </form>`,
-            btn: [i18n['Confirm'], i18n['Cancel']],
+            btn: [i18n['Confirm'], i18n['History'], i18n['Cancel']],
+            success: function () {
+                layui.form.render('select', 'configTemplateForm');
+                layui.form.on('select(configTemplateServer)', function (obj) {
+                    loadConfigTemplateOf(obj.value);
+                });
+                loadConfigTemplateOf('');
+            },
             btn1: function (index) {
-                var newTemplate = $('#configTemplateEditor').val();
-                // 保存到内存中
-                defaultConfigTemplate = newTemplate;
-                
-                // 调用API保存到文件
-                api.saveConfigTemplate(newTemplate)
-                    .then(function() {
+                $('#configTemplateError').hide();
+                api.saveConfigTemplate($('#configTemplateServer').val(), $('#configTemplateEditor').val(), $('#configTemplateComment').val())
+                    .then(function () {
                         layui.layer.close(index);
                     })
-                    .catch(function(error) {
+                    .catch(function (error) {
                         console.error('保存配置模板失败:', error);
+                        if (error && error.message) {
+                            showConfigTemplateError(error);
+                        }
                     });
             },
-            btn2: function (index) {
+            btn2: function () {
+                configTemplateHistoryPopup($('#configTemplateServer').val());
+                return false;
+            },
+            btn3: function (index) {
                 layui.layer.close(index);
             }
         });
     }
 
-    function exportConfig(data) {
-        if (data.length === 0) {
-            layui.layer.msg(i18n['PleaseCheckAtLeastOneUser']);
-            return;
+    // 显示模板校验失败的原因, 能定位到模板中的行时选中该行
+    function showConfigTemplateError(error) {
+        $('#configTemplateErrorMessage').text(error.message);
+        $('#configTemplateRendered').text(error.rendered || '');
+        $('#configTemplateError').show();
+        if (error.line > 0) {
+            var editor = document.getElementById('configTemplateEditor');
+            var lines = editor.value.split('\n');
+            var start = lines.slice(0, error.line - 1).join('\n').length + (error.line > 1 ? 1 : 0);
+            editor.focus();
+            editor.setSelectionRange(start, start + (lines[error.line - 1] || '').length);
         }
+    }
+
+    // 模板的历史版本, 可查看与最新版本的差异或回滚
+    function configTemplateHistoryPopup(server) {
+        layui.layer.open({
+            type: 1,
+            title: i18n['History'] + ' - ' + (server ? escapeHtml(server) : i18n['DefaultTemplate']),
+            area: ['800px', '520px'],
+            content: '<div style="padding: 10px;"><table id="configTemplateVersionTable" lay-filter="configTemplateVersionTable"></table></div>',
+            success: function () {
+                layui.table.render({
+                    elem: '#configTemplateVersionTable',
+                    url: '/api/config_templates',
+                    where: {server: server},
+                    height: 420,
+                    cols: [[
+                        {field: 'version', title: i18n['Version'], width: 90},
+                        {field: 'time', title: i18n['Time'], width: 170},
+                        {field: 'author', title: i18n['Actor'], width: 110},
+                        {field: 'comment', title: i18n['TemplateComment'], templet: function (d) {
+                            return escapeHtml(d.inherit ? i18n['DefaultTemplate'] + (d.comment ? ' / ' + d.comment : '') : d.comment);
+                        }},
+                        {title: i18n['Operation'], width: 150, templet: function () {
+                            return `<a class="layui-btn layui-btn-xs" lay-event="diff">${ i18n['Diff'] }</a>` +
+                                `<a class="layui-btn layui-btn-xs layui-btn-danger" lay-event="rollback">${ i18n['Rollback'] }</a>`;
+                        }}
+                    ]]
+                });
+                layui.table.on('tool(configTemplateVersionTable)', function (obj) {
+                    if (obj.event === 'diff') {
+                        $.getJSON('/api/config_templates/diff', {server: server, from: obj.data.version}, function (result) {
+                            if (!result.success) {
+                                errorMsg(result);
+                                return;
+                            }
+                            layui.layer.open({
+                                type: 1,
+                                title: i18n['Diff'] + ' v' + result.from + ' → v' + result.to,
+                                area: ['760px', '520px'],
+                                content: `<pre style="padding: 10px; margin: 0;">${ diffHtml(result.diff) }</pre>`
+                            });
+                        });
+                    } else if (obj.event === 'rollback') {
+                        layui.layer.confirm(i18n['ConfirmRollback'], {title: i18n['OperationConfirm']}, function (index) {
+                            layui.layer.close(index);
+                            api.rollbackConfigTemplate(server, obj.data.version).done(function (result) {
+                                if (result.success) {
+                                    layui.table.reload('configTemplateVersionTable');
+                                    if ($('#configTemplateServer').val() === server) {
+                                        loadConfigTemplateOf(server);
+                                    }
+                                } else if (result.template && $('#configTemplateServer').val() === server) {
+                                    // 在编辑器中打开未通过校验的版本并定位出错的行
+                                    $('#configTemplateEditor').val(result.template);
+                                    showConfigTemplateError(result);
+                                }
+                            });
+                        });
+                    }
+                });
+            }
+        });
+    }
 
-        var serverIP = window.location.hostname; // 默认值
-        var serverPort = window.location.port; // 默认值
-        var allConfigContents = [];
+    function diffHtml(diff) {
+        return diff.split('\n').map(function (line) {
+            var html = escapeHtml(line);
+            if (line.indexOf('+++') === 0 || line.indexOf('---') === 0) {
+                return '<b>' + html + '</b>';
+            } else if (line.charAt(0) === '+') {
+                return '<span style="color: #16b777;">' + html + '</span>';
+            } else if (line.charAt(0) === '-') {
+                return '<span style="color: #ff5722;">' + html + '</span>';
+            }
+            return html;
+        }).join('\n');
+    }
 
-        data.forEach(function (user) {
-            // 根据 user.server 匹配 dashboardsData 中的服务器信息
-            var matchedDashboard = dashboardsData.find(function(dashboard) {
-                return dashboard.name === user.server;
-            });
+    function weekdayNames() {
+        return [i18n['Sunday'], i18n['Monday'], i18n['Tuesday'], i18n['Wednesday'],
+            i18n['Thursday'], i18n['Friday'], i18n['Saturday']];
+    }
 
-            if (matchedDashboard) {
-                serverIP = matchedDashboard.dashboard_addr || serverIP;
-                serverPort = matchedDashboard.dashboard_port || serverPort;
+    function formatSchedule(schedule) {
+        if (!schedule) {
+            return i18n['NotLimit'];
+        }
+        var names = weekdayNames();
+        var days = (schedule.days || []).map(function (day) {
+            return names[day];
+        }).join(',');
+        var time = schedule.from ? schedule.from + '-' + schedule.to : '';
+        return [days, time, schedule.timezone].filter(function (part) {
+            return part;
+        }).join(' ') || i18n['NotLimit'];
+    }
+
+    function schedulePopup(data) {
+        layui.layer.open({
+            type: 1,
+            title: i18n['Schedule'] + ' - ' + data.user,
+            area: ['600px'],
+            content: layui.laytpl(document.getElementById('scheduleTemplate').innerHTML).render({
+                schedule: data.schedule,
+                weekdays: weekdayNames()
+            }),
+            success: function () {
+                layui.laydate.render({elem: '#scheduleFrom', type: 'time', format: 'HH:mm'});
+                layui.laydate.render({elem: '#scheduleTo', type: 'time', format: 'HH:mm'});
+                layui.form.render(null, 'scheduleForm');
+            },
+            btn: [i18n['Confirm'], i18n['Cancel']],
+            btn1: function (index) {
+                var formData = layui.form.val('scheduleForm');
+                var before = $.extend(true, {}, data), after = $.extend(true, {}, data);
+                if (formData.enable) {
+                    var days = [];
+                    for (var day = 0; day < 7; day++) {
+                        if (formData['day_' + day]) {
+                            days.push(day);
+                        }
+                    }
+                    after.schedule = {
+                        days: days,
+                        from: formData.from.trim(),
+                        to: formData.to.trim(),
+                        timezone: formData.timezone.trim()
+                    };
+                } else {
+                    after.schedule = null;
+                }
+                api.update(before, after).done(function (result) {
+                    if (result.success) {
+                        reloadTable();
+                        layui.layer.close(index);
+                    }
+                });
+            },
+            btn2: function (index) {
+                layui.layer.close(index);
             }
+        });
+    }
+
+    function frpcConfigUrl(user, format, download) {
+        var url = '/api/frpc_config?user=' + encodeURIComponent(user.user) + '&format=' + format;
+        if (user.server) {
+            url += '&server=' + encodeURIComponent(user.server);
+        }
+        return download ? url + '&download=1' : url;
+    }
+
+    function frpcBundleUrl(user) {
+        var url = '/api/frpc_bundle?user=' + encodeURIComponent(user.user);
+        if (user.server) {
+            url += '&server=' + encodeURIComponent(user.server);
+        }
+        return url;
+    }
 
-            var configContent = defaultConfigTemplate;
-            configContent = configContent.replace(/{ServerIP}/g, serverIP);
-            configContent = configContent.replace(/{ServerPort}/g, serverPort);
-            configContent = configContent.replace(/{User}/g, user.user);
-            configContent = configContent.replace(/{token}/g, user.token);
-            // 生成 8 位随机 ProxyName (包含大小写字母和数字)
-            var randomProxyName = generateRandomString(8, 'ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789');
-            configContent = configContent.replace(/{ProxyName}/g, randomProxyName);
-            // 假设每个用户只有一个端口，或者需要用户选择端口
-            // 这里简化处理，如果用户有多个端口，只取第一个
-            var port = user.ports && user.ports.length > 0 ? user.ports[0] : '未知端口';
-            configContent = configContent.replace(/{Port}/g, port);
-            allConfigContents.push(`### frpc_${user.user}.ini ###\n${configContent}\n`);
+    function downloadLink(href, filename) {
+        var link = document.createElement('a');
+        link.href = href;
+        link.download = filename;
+        document.body.appendChild(link);
+        link.click();
+        document.body.removeChild(link);
+    }
+
+    // 配置由服务端根据模板生成, 每个用户单独请求
+    function loadExportedConfig(data, format) {
+        var requests = data.map(function (user) {
+            return $.ajax({url: frpcConfigUrl(user, format), dataType: 'text'}).then(function (content) {
+                return `### frpc_${user.user}.${format} ###\n${content}\n`;
+            }, function (xhr) {
+                var message = xhr.responseJSON && xhr.responseJSON.message ? xhr.responseJSON.message : xhr.statusText;
+                return $.Deferred().resolve(`### frpc_${user.user}.${format} ###\n# ${message}\n`);
+            });
         });
+        $.when.apply($, requests).then(function () {
+            $('#exportedConfigContent').val(Array.prototype.slice.call(arguments).join('\n'));
+        });
+    }
 
-        var finalContent = allConfigContents.join('\n');
+    function exportConfig(data) {
+        if (data.length === 0) {
+            layui.layer.msg(i18n['PleaseCheckAtLeastOneUser']);
+            return;
+        }
 
         layui.layer.open({
             type: 1,
             title: i18n['ExportConfig'],
             area: ['800px', '600px'],
-            content: `<form class="layui-form" style="padding: 20px;">
+            content: `<form class="layui-form" lay-filter="exportConfigForm" style="padding: 20px;">
+                <div class="layui-form-item">
+                    <label class="layui-form-label">${ i18n['ConfigFormat'] }</label>
+                    <div class="layui-input-inline">
+                        <select id="exportConfigFormat" lay-filter="exportConfigFormat">
+                            <option value="toml">TOML</option>
+                            <option value="yaml">YAML</option>
+                            <option value="json">JSON</option>
+                            <option value="ini">INI</option>
+                        </select>
+                    </div>
+                </div>
                 <div class="layui-form-item layui-form-text">
                     <label class="layui-form-label">${ i18n['ConfigTemplate'] }</label>
                     <div class="layui-input-block">
-                        <textarea id="exportedConfigContent" class="layui-textarea" style="height: 400px; white-space: pre;">${ finalContent }</textarea>
+                        <textarea id="exportedConfigContent" class="layui-textarea" style="height: 360px; white-space: pre;" readonly></textarea>
                     </div>
                 </div>
             </form>`,
-            btn: [i18n['Confirm'], i18n['Cancel']],
+            btn: [i18n['Copy'], i18n['Download'], i18n['DownloadBundle'], i18n['Cancel']],
+            success: function () {
+                layui.form.render('select', 'exportConfigForm');
+                layui.form.on('select(exportConfigFormat)', function (obj) {
+                    loadExportedConfig(data, obj.value);
+                });
+                loadExportedConfig(data, 'toml');
+            },
             btn1: function (index) {
                 var textarea = document.getElementById('exportedConfigContent');
                 textarea.select();
                 document.execCommand('copy');
                 layui.layer.close(index);
-                layui.layer.msg(i18n['OperateSuccess'] + ', 配置已复制到剪贴板');
+                layui.layer.msg(i18n['CopiedToClipboard']);
             },
-            btn2: function (index) {
+            btn2: function () {
+                var format = $('#exportConfigFormat').val();
+                data.forEach(function (user) {
+                    downloadLink(frpcConfigUrl(user, format, true), 'frpc_' + user.user + '.' + format);
+                });
+                return false;
+            },
+            btn3: function () {
+                data.forEach(function (user) {
+                    downloadLink(frpcBundleUrl(user), 'frpc_' + user.user + '.zip');
+                });
+                return false;
+            },
+            btn4: function (index) {
                 layui.layer.close(index);
             }
         });
@@ -317,7 +542,6 @@
         api = apiModule;
         validatorRules = validatorModuleRules;
         dashboardsData = dashboards; // 存储 dashboards 数据
-        loadConfigTemplate(); // 加载配置模板
     };
 
     exports.reloadTable = reloadTable;
@@ -349,5 +573,206 @@
     exports.confirmPopup = confirmPopup;
     exports.editConfigTemplatePopup = editConfigTemplatePopup;
     exports.exportConfig = exportConfig;
+    exports.formatSchedule = formatSchedule;
+    exports.schedulePopup = schedulePopup;
+
+    function splitValues(value) {
+        return value.split(',').map(function (v) {
+            return v.trim();
+        }).filter(function (v) {
+            return v !== '';
+        });
+    }
+
+    function serversPopup(data) {
+        var names = dashboardsData.map(function (dashboard) {
+            return dashboard.name;
+        });
+        var servers = data.servers && data.servers.length > 0 ? data.servers : (data.server ? [{
+            server: data.server,
+            ports: data.ports,
+            domains: data.domains,
+            subdomains: data.subdomains
+        }] : []);
+        var claimLimit = data.subdomain_claim_limit;
+        var render = function (allocations) {
+            return layui.laytpl(document.getElementById('serversTemplate').innerHTML).render({
+                servers: allocations,
+                names: names,
+                claim_limit: claimLimit
+            });
+        };
+        // 空值表示使用全局的 subdomain_claim_limit
+        var readClaimLimit = function () {
+            var value = $.trim($('#subdomainClaimLimit').val());
+            return value === '' ? null : parseInt(value, 10);
+        };
+        // 读取表单中当前填写的分配
+        var collect = function () {
+            var allocations = [];
+            $('#serversRows .server-row').each(function () {
+                var row = $(this);
+                allocations.push({
+                    server: row.find('select').val(),
+                    ports: splitValues(row.find('input[name^="ports_"]').val()),
+                    domains: splitValues(row.find('input[name^="domains_"]').val()),
+                    subdomains: splitValues(row.find('input[name^="subdomains_"]').val())
+                });
+            });
+            return allocations;
+        };
+        layui.layer.open({
+            type: 1,
+            title: i18n['Servers'] + ' - ' + data.user,
+            area: ['900px'],
+            content: '<div id="serversContainer">' + render(servers) + '</div>',
+            success: function (layero) {
+                layero.on('click', '#addServer', function () {
+                    claimLimit = readClaimLimit();
+                    var allocations = collect();
+                    allocations.push({server: names[0] || '', ports: [], domains: [], subdomains: []});
+                    $('#serversContainer').html(render(allocations));
+                });
+                layero.on('click', '.remove-server', function () {
+                    claimLimit = readClaimLimit();
+                    $(this).closest('tr').remove();
+                    $('#serversContainer').html(render(collect()));
+                });
+            },
+            btn: [i18n['Confirm'], i18n['Cancel']],
+            btn1: function (index) {
+                var before = $.extend(true, {}, data), after = $.extend(true, {}, data);
+                after.servers = collect();
+                after.subdomain_claim_limit = readClaimLimit();
+                if (after.subdomain_claim_limit !== null && (isNaN(after.subdomain_claim_limit) || after.subdomain_claim_limit < 0)) {
+                    layui.layer.msg(i18n['OperateFailed']);
+                    return;
+                }
+                api.update(before, after).done(function (result) {
+                    if (result.success) {
+                        reloadTable();
+                        layui.layer.close(index);
+                    }
+                });
+            },
+            btn2: function (index) {
+                layui.layer.close(index);
+            }
+        });
+    }
+    exports.serversPopup = serversPopup;
+
+    function policyPopup(data) {
+        layui.layer.open({
+            type: 1,
+            title: i18n['Policy'] + ' - ' + data.user,
+            area: ['600px'],
+            content: layui.laytpl(document.getElementById('policyTemplate').innerHTML).render({
+                policy: data.policy
+            }),
+            success: function () {
+                layui.form.render(null, 'policyForm');
+            },
+            btn: [i18n['Confirm'], i18n['Cancel']],
+            btn1: function (index) {
+                var formData = layui.form.val('policyForm');
+                var before = $.extend(true, {}, data), after = $.extend(true, {}, data);
+                var policy = {
+                    force_encryption: !!formData.force_encryption,
+                    force_compression: !!formData.force_compression,
+                    bandwidth_limit: formData.bandwidth_limit.trim(),
+                    prefix_proxy_name: !!formData.prefix_proxy_name,
+                    pin_remote_port: !!formData.pin_remote_port
+                };
+                var empty = !policy.force_encryption && !policy.force_compression && policy.bandwidth_limit === '' &&
+                    !policy.prefix_proxy_name && !policy.pin_remote_port;
+                after.policy = empty ? null : policy;
+                api.update(before, after).done(function (result) {
+                    if (result.success) {
+                        reloadTable();
+                        layui.layer.close(index);
+                    }
+                });
+            },
+            btn2: function (index) {
+                layui.layer.close(index);
+            }
+        });
+    }
+    exports.policyPopup = policyPopup;
+
+    function formatQuota(data) {
+        if (!data.quota) return i18n['Unlimited'];
+        var usage = filesize(data.quota_used || 0) + ' / ' + data.quota;
+        if (data.quota_top_up > 0) usage += ' + ' + filesize(data.quota_top_up);
+        return usage;
+    }
+    exports.formatQuota = formatQuota;
+
+    function quotaPopup(data) {
+        layui.layer.open({
+            type: 1,
+            title: i18n['Quota'] + ' - ' + data.user,
+            area: ['500px'],
+            content: layui.laytpl(document.getElementById('quotaTemplate').innerHTML).render({
+                quota: data.quota,
+                quota_reset_day: data.quota_reset_day,
+                usage: formatQuota(data)
+            }),
+            success: function (layero, index) {
+                layui.form.render(null, 'quotaForm');
+                $('#quotaTopUpBtn').on('click', function () {
+                    var amount = layui.form.val('quotaForm').amount.trim();
+                    if (!/^\d+(\.\d+)?(MB|GB|TB)$/.test(amount)) {
+                        layui.layer.msg(i18n['QuotaInvalid']);
+                        return;
+                    }
+                    api.topUpQuota(data.user, amount).done(function (result) {
+                        if (result.success) {
+                            reloadTable();
+                            layui.layer.close(index);
+                        }
+                    });
+                });
+            },
+            btn: [i18n['Confirm'], i18n['Cancel']],
+            btn1: function (index) {
+                var formData = layui.form.val('quotaForm');
+                var quota = formData.quota.trim(), resetDay = parseInt(formData.quota_reset_day || '0', 10);
+                if ((quota !== '' && !/^\d+(\.\d+)?(MB|GB|TB)$/.test(quota)) || isNaN(resetDay) || resetDay < 0 || resetDay > 28) {
+                    layui.layer.msg(i18n['QuotaInvalid']);
+                    return;
+                }
+                var before = $.extend(true, {}, data), after = $.extend(true, {}, data);
+                after.quota = quota;
+                after.quota_reset_day = resetDay;
+                api.update(before, after).done(function (result) {
+                    if (result.success) {
+                        reloadTable();
+                        layui.layer.close(index);
+                    }
+                });
+            },
+            btn2: function (index) {
+                layui.layer.close(index);
+            }
+        });
+    }
+    exports.quotaPopup = quotaPopup;
+
+    function kickPopup(data) {
+        layui.layer.confirm(i18n['ConfirmKickUser'], {
+            title: i18n['OperationConfirm'],
+            btn: [i18n['Confirm'], i18n['AllowReconnect'], i18n['Cancel']],
+            btn2: function (index) {
+                layui.layer.close(index);
+                api.unkickUser(data.user);
+            }
+        }, function (index) {
+            layui.layer.close(index);
+            api.kickUser(data.user);
+        });
+    }
+    exports.kickPopup = kickPopup;
 
 })(window.UserListUI = window.UserListUI || {}, layui.$);
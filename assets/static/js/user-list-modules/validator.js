@@ -61,7 +61,7 @@
         if (domains.trim() !== '') {
             try {
                 domains.split(',').forEach(function (domain) {
-                    if (!/^([a-zA-Z0-9]+(-[a-zA-Z0-9]+)*\.)+[a-zA-Z]{2,}$/.test(domain.trim())) {
+                    if (!/^(\*\.|\.)?([a-zA-Z0-9]+(-[a-zA-Z0-9]+)*\.)+[a-zA-Z]{2,}$/.test(domain.trim())) {
                         valid = false;
                         throw 'break';
                     }
@@ -77,7 +77,7 @@
         if (subdomains.trim() !== '') {
             try {
                 subdomains.split(',').forEach(function (subdomain) {
-                    if (!/^[a-zA-z0-9][a-zA-z0-9-]{0,19}$/.test(subdomain.trim())) {
+                    if (!/^[a-zA-Z0-9][a-zA-Z0-9-]{0,19}$/.test(subdomain.trim())) {
                         valid = false;
                         throw 'break';
                     }
@@ -96,6 +96,14 @@
         return {valid: valid, trim: expireDate.trim()};
     }
 
+    function verifyBandwidth(bandwidth) {
+        var valid = true;
+        if (bandwidth.trim() !== '' && !/^\d+(\.\d+)?(KB|MB)$/.test(bandwidth.trim())) {
+            valid = false;
+        }
+        return {valid: valid, trim: bandwidth.trim()};
+    }
+
     exports.createRules = function (i18n) {
         return {
             user: function (value, item) {
@@ -147,6 +155,20 @@
                     typeof item === "function" ? item(result.trim) : $(item).val(result.trim);
                 }
             },
+            bandwidth_upload: function (value, item) {
+                var result = verifyBandwidth(value);
+                if (!result.valid) return i18n['BandwidthInvalid'];
+                if (item != null) {
+                    typeof item === "function" ? item(result.trim) : $(item).val(result.trim);
+                }
+            },
+            bandwidth_download: function (value, item) {
+                var result = verifyBandwidth(value);
+                if (!result.valid) return i18n['BandwidthInvalid'];
+                if (item != null) {
+                    typeof item === "function" ? item(result.trim) : $(item).val(result.trim);
+                }
+            },
             server: function (value) {
                 if (value === '') return i18n['PleaseSelectServer'];
             }
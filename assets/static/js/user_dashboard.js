@@ -1,9 +1,33 @@
-layui.use(['element', 'table', 'jquery', 'form'], function () {
+layui.use(['element', 'table', 'jquery', 'form', 'laytpl'], function () {
     var element = layui.element;
     var table = layui.table;
     var $ = layui.jquery;
     var form = layui.form; // 引入 form 模块
     var dashboardsData = [];
+    var serversData = []; // 当前用户被分配的服务器
+    var selectedServer = '';
+    var subdomainClaimLimit = 0;
+
+    function proxiesUrl(proxyType) {
+        var url = '/api/user/proxies?proxyType=' + proxyType;
+        if (selectedServer) {
+            url += '&server=' + encodeURIComponent(selectedServer);
+        }
+        return url;
+    }
+
+    // 工具栏会随表格重新渲染, 需要重新填充服务器下拉框
+    function renderServerSelect() {
+        var serverSelect = $('#serverSelect');
+        serverSelect.empty();
+        serversData.forEach(function (server) {
+            serverSelect.append('<option value="' + server + '">' + server + '</option>');
+        });
+        if (selectedServer) {
+            serverSelect.val(selectedServer);
+        }
+        form.render('select', 'proxyTypeForm');
+    }
 
     $.getJSON('/api/user/dashboards', function(res) {
         if (res.data) {
@@ -53,7 +77,15 @@ layui.use(['element', 'table', 'jquery', 'form'], function () {
             {field: 'user', title: '用户'},
             {field: 'token', title: '令牌'},
             {field: 'comment', title: '备注'},
-            {field: 'server', title: '服务器名'},
+            {field: 'servers', title: '服务器', templet: function (d) {
+                if (d.servers && d.servers.length > 0) {
+                    return d.servers.map(function (allocation) {
+                        var ports = allocation.ports && allocation.ports.length > 0 ? allocation.ports.join(', ') : '无';
+                        return allocation.server + ' (' + ports + ')';
+                    }).join('<br/>');
+                }
+                return '不限';
+            }},
             {field: 'ports', title: '允许端口', templet: function (d) {
                 if (d.ports && d.ports.length > 0) {
                     return d.ports.join(', ');
@@ -72,6 +104,19 @@ layui.use(['element', 'table', 'jquery', 'form'], function () {
                 }
                 return '无';
             }},
+            {field: 'bandwidth', title: '带宽(上传/下载)', templet: function (d) {
+                return (d.bandwidth_upload || '不限') + ' / ' + (d.bandwidth_download || '不限');
+            }},
+            {field: 'quota', title: '本月流量(已用/配额)', templet: function (d) {
+                if (!d.quota) {
+                    return '不限';
+                }
+                var usage = filesize(d.quota_used || 0) + ' / ' + d.quota;
+                if (d.quota_top_up > 0) {
+                    usage += ' + ' + filesize(d.quota_top_up);
+                }
+                return usage + '，每月 ' + (d.quota_reset_day || 1) + ' 日重置';
+            }},
             {field: 'create_date', title: '创建日期'},
             {field: 'expire_date', title: '到期日期', templet: function (d) {
                 if (d.expire_date) {
@@ -81,6 +126,15 @@ layui.use(['element', 'table', 'jquery', 'form'], function () {
             }}
         ]],
         page: false,
+        parseData: function (res) {
+            if (res.data && res.data.length > 0) {
+                serversData = (res.data[0].servers || []).map(function (allocation) {
+                    return allocation.server;
+                });
+                renderServerSelect();
+            }
+            return res;
+        },
         done: function (res, curr, count) {
             // 如果没有数据，显示空数据提示
             if (count === 0) {
@@ -89,6 +143,155 @@ layui.use(['element', 'table', 'jquery', 'form'], function () {
         }
     });
 
+    // 子域名表格
+    table.render({
+        elem: '#subdomainClaimsTable',
+        url: '/api/user/subdomains',
+        toolbar: '#subdomainToolbar',
+        defaultToolbar: [],
+        cols: [[
+            {field: 'server', title: '服务器', templet: function (d) {
+                return d.server || '所有服务器';
+            }},
+            {field: 'subdomain', title: '子域名'},
+            {field: 'create_date', title: '申请日期'},
+            {title: '操作', toolbar: '#subdomainOperationTpl', width: 100}
+        ]],
+        page: false,
+        parseData: function (res) {
+            subdomainClaimLimit = res.limit;
+            return res;
+        },
+        done: function (res, curr, count) {
+            if (count === 0) {
+                this.elem.next('.layui-table-view').find('.layui-table-none').html('<div class="layui-none">暂无数据，最多可申请 ' + subdomainClaimLimit + ' 个子域名</div>');
+            }
+        }
+    });
+
+    table.on('toolbar(subdomainClaimsTable)', function (obj) {
+        if (obj.event === 'refresh') {
+            table.reload('subdomainClaimsTable');
+        } else if (obj.event === 'claim') {
+            claimSubdomain();
+        }
+    });
+
+    table.on('tool(subdomainClaimsTable)', function (obj) {
+        if (obj.event === 'release') {
+            layui.layer.confirm('确定释放子域名 ' + obj.data.subdomain + ' 吗？', function (index) {
+                postJSON('/api/user/subdomains/release', {
+                    server: obj.data.server,
+                    subdomain: obj.data.subdomain
+                }, function () {
+                    table.reload('subdomainClaimsTable');
+                });
+                layui.layer.close(index);
+            });
+        }
+    });
+
+    function postJSON(url, data, success) {
+        $.ajax({
+            url: url,
+            type: 'post',
+            contentType: 'application/json',
+            data: JSON.stringify(data),
+            success: function (result) {
+                if (result.success) {
+                    layui.layer.msg('操作成功');
+                    success(result);
+                } else {
+                    layui.layer.msg('操作失败：' + result.message);
+                }
+            },
+            error: function () {
+                layui.layer.msg('操作失败');
+            }
+        });
+    }
+
+    function claimSubdomain() {
+        // 未分配服务器的用户可以使用所有服务器, 也可以申请对所有服务器有效的子域名
+        var servers = serversData.length > 0 ? serversData : [''].concat(dashboardsData.map(function (dashboard) {
+            return dashboard.name;
+        }));
+        layui.layer.open({
+            type: 1,
+            title: '申请子域名',
+            area: ['450px'],
+            content: layui.laytpl(document.getElementById('claimSubdomainTemplate').innerHTML).render({servers: servers}),
+            success: function () {
+                form.render(null, 'claimSubdomainForm');
+            },
+            btn: ['确定', '取消'],
+            btn1: function (index) {
+                var formData = form.val('claimSubdomainForm');
+                postJSON('/api/user/subdomains/claim', {
+                    server: formData.server,
+                    subdomain: formData.subdomain.trim()
+                }, function () {
+                    table.reload('subdomainClaimsTable');
+                    layui.layer.close(index);
+                });
+            }
+        });
+    }
+
+    // 流量统计图表
+    var trafficChart = null;
+
+    function loadTrafficHistory(period) {
+        $('#trafficDailyBtn').toggleClass('layui-btn-primary', period !== 'daily');
+        $('#trafficMonthlyBtn').toggleClass('layui-btn-primary', period !== 'monthly');
+        $.getJSON('/api/user/traffic/' + period, function (res) {
+            if (res.code !== 0) {
+                layui.layer.msg('流量统计查询失败：' + res.msg);
+                return;
+            }
+            var periods = [], trafficIn = [], trafficOut = [];
+            res.data.forEach(function (stat) {
+                periods.push(stat.period);
+                trafficIn.push(stat.traffic_in);
+                trafficOut.push(stat.traffic_out);
+            });
+            if (trafficChart == null) {
+                trafficChart = echarts.init(document.getElementById('trafficHistoryChart'));
+            }
+            trafficChart.setOption({
+                tooltip: {
+                    trigger: 'axis',
+                    formatter: function (params) {
+                        var html = params[0].axisValue;
+                        params.forEach(function (param) {
+                            html += '<br/>' + param.marker + param.seriesName + ': ' + filesize(param.value);
+                        });
+                        return html;
+                    }
+                },
+                legend: {data: ['流入', '流出']},
+                xAxis: {type: 'category', data: periods},
+                yAxis: {
+                    type: 'value',
+                    axisLabel: {
+                        formatter: function (value) {
+                            return filesize(value);
+                        }
+                    }
+                },
+                series: [
+                    {name: '流入', type: 'bar', data: trafficIn},
+                    {name: '流出', type: 'bar', data: trafficOut}
+                ]
+            }, true);
+        });
+    }
+
+    $('#trafficDailyBtn, #trafficMonthlyBtn').on('click', function () {
+        loadTrafficHistory($(this).data('period'));
+    });
+    loadTrafficHistory('daily');
+
     // 代理列表表格
     table.render({
         elem: '#userProxiesTable',
@@ -114,14 +317,14 @@ layui.use(['element', 'table', 'jquery', 'form'], function () {
                 this.elem.next('.layui-table-view').find('.layui-table-none').html('<div class="layui-none">暂无数据</div>');
             }
             // 在表格渲染完成后渲染表单，确保下拉菜单正确显示
-            form.render('select', 'proxyTypeForm');
+            renderServerSelect();
         }
     });
 
     // 监听协议类型选择
     form.on('select(proxyTypeSelect)', function(data){
         table.reload('userProxiesTable', {
-            url: '/api/user/proxies?proxyType=' + data.value
+            url: proxiesUrl(data.value)
         });
         
         // 使用Layui的form.val方法来正确设置值
@@ -133,6 +336,14 @@ layui.use(['element', 'table', 'jquery', 'form'], function () {
         form.render('select', 'proxyTypeForm');
     });
 
+    // 监听服务器选择
+    form.on('select(serverSelect)', function (data) {
+        selectedServer = data.value;
+        table.reload('userProxiesTable', {
+            url: proxiesUrl($('#proxyTypeSelect').val() || 'tcp')
+        });
+    });
+
     // 监听Tab切换
     element.on('tab(tab)', function (data) {
         var layId = $(this).attr('lay-id');
@@ -144,7 +355,7 @@ layui.use(['element', 'table', 'jquery', 'form'], function () {
             // 保留当前选择的协议类型
             var currentProxyType = $('#proxyTypeSelect').val() || 'http';
             table.reload('userProxiesTable', {
-                url: '/api/user/proxies?proxyType=' + currentProxyType
+                url: proxiesUrl(currentProxyType)
             });
         }
     });
@@ -162,81 +373,154 @@ layui.use(['element', 'table', 'jquery', 'form'], function () {
                 return;
             }
             exportConfig(data);
+        } else if (obj.event === 'rotateToken') {
+            var data = table.cache.userInfoTable;
+            if (data.length === 0) {
+                layui.layer.msg('请先加载用户信息');
+                return;
+            }
+            rotateToken(data);
         }
     });
 
     table.on('toolbar(userProxiesTable)', function (obj) {
         if (obj.event === 'refresh') {
             table.reload('userProxiesTable', {
-                url: '/api/user/proxies?proxyType=' + $('#proxyTypeSelect').val()
+                url: proxiesUrl($('#proxyTypeSelect').val())
             });
         }
     });
 
-    function generateRandomString(length, characters) {
-        var result = '';
-        for (var i = 0; i < length; i++) {
-            result += characters.charAt(Math.floor(Math.random() * characters.length));
+    function frpcConfigUrl(format, download) {
+        var url = '/api/user/frpc_config?format=' + format;
+        if (selectedServer) {
+            url += '&server=' + encodeURIComponent(selectedServer);
         }
-        return result;
+        return download ? url + '&download=1' : url;
     }
 
-    function exportConfig(data) {
-        $.getJSON('../static/config_template.json', function (config) {
-            var defaultConfigTemplate = config.template;
-            var allConfigContents = [];
+    function downloadLink(href, filename) {
+        var link = document.createElement('a');
+        link.href = href;
+        link.download = filename;
+        document.body.appendChild(link);
+        link.click();
+        document.body.removeChild(link);
+    }
 
-            data.forEach(function (user) {
-                var serverIP = window.location.hostname; // 默认值
-                var serverPort = window.location.port || (window.location.protocol === 'https:' ? 443 : 80); // 默认值
+    // 配置由服务端根据模板生成
+    function loadExportedConfig(format) {
+        $.ajax({url: frpcConfigUrl(format), dataType: 'text'}).done(function (content) {
+            $('#exportedConfigContent').val(content);
+        }).fail(function (xhr) {
+            var message = xhr.responseJSON && xhr.responseJSON.message ? xhr.responseJSON.message : xhr.statusText;
+            $('#exportedConfigContent').val('# ' + message);
+        });
+    }
 
-                var matchedDashboard = dashboardsData.find(function(dashboard) {
-                    return dashboard.name === user.server;
+    // 更换 token 后旧 token 可在选择的时间内继续用于 frpc, 面板登录密码同时改为新 token
+    function rotateToken(data) {
+        layui.layer.open({
+            type: 1,
+            title: '更换 Token',
+            area: ['460px', '300px'],
+            content: `<form class="layui-form" lay-filter="rotateTokenForm" style="padding: 20px;">
+                <div class="layui-form-item">
+                    <label class="layui-form-label">旧 Token</label>
+                    <div class="layui-input-block">
+                        <select id="rotateTokenGrace">
+                            <option value="0">立即失效</option>
+                            <option value="10">保留 10 分钟</option>
+                            <option value="60">保留 60 分钟</option>
+                        </select>
+                    </div>
+                </div>
+                <div class="layui-form-mid layui-word-aux">新 Token 同时作为面板登录密码, 请更新所有 frpc 的配置</div>
+            </form>`,
+            btn: ['更换', '取消'],
+            success: function () {
+                form.render('select', 'rotateTokenForm');
+            },
+            btn1: function (index) {
+                $.ajax({
+                    url: '/api/user/rotate-token' + (selectedServer ? '?server=' + encodeURIComponent(selectedServer) : ''),
+                    type: 'post',
+                    contentType: 'application/json',
+                    data: JSON.stringify({grace_minutes: parseInt($('#rotateTokenGrace').val(), 10)})
+                }).done(function () {
+                    layui.layer.close(index);
+                    layui.layer.msg('Token 已更换');
+                    table.reload('userInfoTable', {
+                        url: '/api/user/info'
+                    });
+                    exportConfig(data);
+                }).fail(function (xhr) {
+                    var message = xhr.responseJSON && xhr.responseJSON.message ? xhr.responseJSON.message : xhr.statusText;
+                    layui.layer.msg(message);
                 });
+            },
+            btn2: function (index) {
+                layui.layer.close(index);
+            }
+        });
+    }
 
-                if (matchedDashboard) {
-                    serverIP = matchedDashboard.dashboard_addr || serverIP;
-                    serverPort = matchedDashboard.dashboard_port || serverPort;
-                }
-
-                var configContent = defaultConfigTemplate;
-                configContent = configContent.replace(/{ServerIP}/g, serverIP);
-                configContent = configContent.replace(/{ServerPort}/g, serverPort);
-                configContent = configContent.replace(/{User}/g, user.user);
-                configContent = configContent.replace(/{token}/g, user.token);
-                var randomProxyName = generateRandomString(8, 'ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789');
-                configContent = configContent.replace(/{ProxyName}/g, randomProxyName);
-                var port = user.ports && user.ports.length > 0 ? user.ports[0] : '未知端口';
-                configContent = configContent.replace(/{Port}/g, port);
-                allConfigContents.push(`### frpc_${user.user}.ini ###\n${configContent}\n`);
-            });
-
-            var finalContent = allConfigContents.join('\n');
-
-            layui.layer.open({
-                type: 1,
-                title: '导出配置',
-                area: ['800px', '600px'],
-                content: `<form class="layui-form" style="padding: 20px;">
-                    <div class="layui-form-item layui-form-text">
-                        <label class="layui-form-label">配置模板</label>
-                        <div class="layui-input-block">
-                            <textarea id="exportedConfigContent" class="layui-textarea" style="height: 400px; white-space: pre;">${finalContent}</textarea>
-                        </div>
+    function exportConfig(data) {
+        var user = data[0].user;
+        layui.layer.open({
+            type: 1,
+            title: '导出配置',
+            area: ['800px', '600px'],
+            content: `<form class="layui-form" lay-filter="exportConfigForm" style="padding: 20px;">
+                <div class="layui-form-item">
+                    <label class="layui-form-label">格式</label>
+                    <div class="layui-input-inline">
+                        <select id="exportConfigFormat" lay-filter="exportConfigFormat">
+                            <option value="toml">TOML</option>
+                            <option value="yaml">YAML</option>
+                            <option value="json">JSON</option>
+                            <option value="ini">INI</option>
+                        </select>
                     </div>
-                </form>`,
-                btn: ['确认', '取消'],
-                btn1: function (index) {
-                    var textarea = document.getElementById('exportedConfigContent');
-                    textarea.select();
-                    document.execCommand('copy');
-                    layui.layer.close(index);
-                    layui.layer.msg('操作成功, 配置已复制到剪贴板');
-                },
-                btn2: function (index) {
-                    layui.layer.close(index);
+                </div>
+                <div class="layui-form-item layui-form-text">
+                    <label class="layui-form-label">配置</label>
+                    <div class="layui-input-block">
+                        <textarea id="exportedConfigContent" class="layui-textarea" style="height: 360px; white-space: pre;" readonly></textarea>
+                    </div>
+                </div>
+            </form>`,
+            btn: ['复制', '下载', '安装包 (zip)', '取消'],
+            success: function () {
+                form.render('select', 'exportConfigForm');
+                form.on('select(exportConfigFormat)', function (obj) {
+                    loadExportedConfig(obj.value);
+                });
+                loadExportedConfig('toml');
+            },
+            btn1: function (index) {
+                var textarea = document.getElementById('exportedConfigContent');
+                textarea.select();
+                document.execCommand('copy');
+                layui.layer.close(index);
+                layui.layer.msg('已复制到剪贴板');
+            },
+            btn2: function () {
+                var format = $('#exportConfigFormat').val();
+                downloadLink(frpcConfigUrl(format, true), 'frpc_' + user + '.' + format);
+                return false;
+            },
+            btn3: function () {
+                var url = '/api/user/bundle';
+                if (selectedServer) {
+                    url += '?server=' + encodeURIComponent(selectedServer);
                 }
-            });
+                downloadLink(url, 'frpc_' + user + '.zip');
+                return false;
+            },
+            btn4: function (index) {
+                layui.layer.close(index);
+            }
         });
     }
 });
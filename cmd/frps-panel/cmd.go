@@ -21,13 +21,18 @@ import (
 const version = "2.0.0"
 
 var (
-	showVersion bool
-	configFile  string
+	showVersion  bool
+	configFile   string
+	oldSecretKey string
 )
 
+const oldSecretKeyEnv = "FRPS_PANEL_OLD_SECRET_KEY"
+
 func init() {
 	rootCmd.PersistentFlags().BoolVarP(&showVersion, "version", "v", false, "version of frps-panel")
 	rootCmd.PersistentFlags().StringVarP(&configFile, "config", "c", "./frps-panel.toml", "config file of frps-panel")
+	rekeyCmd.Flags().StringVar(&oldSecretKey, "old-key", "", "previous secret key, empty if credentials are stored in plain text (env "+oldSecretKeyEnv+")")
+	rootCmd.AddCommand(rekeyCmd)
 }
 
 var rootCmd = &cobra.Command{
@@ -53,40 +58,7 @@ var rootCmd = &cobra.Command{
 
 		// Database initialization
 		if config.Database.Enable {
-			log.Println("Database is enabled, connecting to database...")
-			dsn := config.Database.Dsn
-			cfg, err := mysql.ParseDSN(dsn)
-			if err != nil {
-				log.Fatalf("failed to parse database DSN: %v", err)
-			}
-			dbName := cfg.DBName
-			cfg.DBName = ""
-			sqlDB, err := sql.Open("mysql", cfg.FormatDSN())
-			if err != nil {
-				log.Fatalf("failed to connect to database server: %v", err)
-			}
-			_, err = sqlDB.Exec(fmt.Sprintf("CREATE DATABASE IF NOT EXISTS `%s`", dbName))
-			if err != nil {
-				sqlDB.Close()
-				log.Fatalf("failed to create database: %v", err)
-			}
-			sqlDB.Close()
-			log.Printf("Database '%s' created or already exists.", dbName)
-			db, err := gorm.Open(gormysql.Open(dsn), &gorm.Config{})
-			if err != nil {
-				log.Fatalf("failed to connect database: %v", err)
-			}
-			config.DB = db
-			log.Println("Database connection successful.")
-
-			// Auto migrate the schema
-			err = db.AutoMigrate(&model.UserToken{}, &model.ServerInfo{})
-			if err != nil {
-				log.Fatalf("failed to auto migrate database schema: %v", err)
-			}
-			log.Println("Database schema migrated.")
-
-			log.Println("Database initialization complete.")
+			config.DB = openDatabase(config.Database.Dsn)
 		} else {
 			log.Println("Database is disabled. Please enable it in the config file.")
 		}
@@ -107,12 +79,92 @@ var rootCmd = &cobra.Command{
 	},
 }
 
+// rekeyCmd 在更换 secret_key 后用新密钥重新加密 dashboard 凭据
+var rekeyCmd = &cobra.Command{
+	Use:   "rekey",
+	Short: "re-encrypt frps dashboard credentials with the current secret key",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, _, err := parseConfigFile(configFile)
+		if err != nil {
+			return err
+		}
+		if !config.Database.Enable {
+			return fmt.Errorf("database is disabled")
+		}
+		oldKey := strings.TrimSpace(oldSecretKey)
+		if oldKey == "" {
+			oldKey = strings.TrimSpace(os.Getenv(oldSecretKeyEnv))
+		}
+		newKey := controller.SecretKey(config.CommonInfo)
+		if newKey == "" {
+			log.Printf("secret key is empty, dashboard credentials will be stored in plain text")
+		}
+
+		db := openDatabase(config.Database.Dsn)
+		count, err := controller.SealServerSecrets(db, oldKey, newKey)
+		if err != nil {
+			log.Printf("failed to re-encrypt dashboard credentials: %v", err)
+			return err
+		}
+		log.Printf("re-encrypted dashboard credentials of %d servers", count)
+		return nil
+	},
+}
+
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
 		os.Exit(1)
 	}
 }
 
+// openDatabase 创建数据库并迁移表结构, 失败时退出
+func openDatabase(dsn string) *gorm.DB {
+	log.Println("Database is enabled, connecting to database...")
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		log.Fatalf("failed to parse database DSN: %v", err)
+	}
+	dbName := cfg.DBName
+	cfg.DBName = ""
+	sqlDB, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		log.Fatalf("failed to connect to database server: %v", err)
+	}
+	_, err = sqlDB.Exec(fmt.Sprintf("CREATE DATABASE IF NOT EXISTS `%s`", dbName))
+	if err != nil {
+		sqlDB.Close()
+		log.Fatalf("failed to create database: %v", err)
+	}
+	sqlDB.Close()
+	log.Printf("Database '%s' created or already exists.", dbName)
+	db, err := gorm.Open(gormysql.Open(dsn), &gorm.Config{})
+	if err != nil {
+		log.Fatalf("failed to connect database: %v", err)
+	}
+	log.Println("Database connection successful.")
+
+	// 插件密钥需要在建立唯一索引之前补齐
+	err = controller.MigratePluginKeys(db)
+	if err != nil {
+		log.Fatalf("failed to migrate plugin keys: %v", err)
+	}
+
+	// Auto migrate the schema
+	err = db.AutoMigrate(&model.UserToken{}, &model.ServerInfo{}, &model.UserServer{}, &model.SubdomainClaim{}, &model.PluginLog{}, &model.AdminAudit{}, &model.ProxyTrafficCursor{}, &model.TrafficDaily{}, &model.ServerProbe{}, &model.ServerStatusEvent{}, &model.ConfigTemplate{})
+	if err != nil {
+		log.Fatalf("failed to auto migrate database schema: %v", err)
+	}
+	log.Println("Database schema migrated.")
+
+	err = controller.MigrateUserServers(db)
+	if err != nil {
+		log.Fatalf("failed to migrate user servers: %v", err)
+	}
+
+	log.Println("Database initialization complete.")
+	return db
+}
+
 func parseConfigFile(configFile string) (controller.HandleController, server.TLS, error) {
 	var commonCfg controller.Common
 	_, err := toml.DecodeFile(configFile, &commonCfg)
@@ -0,0 +1,235 @@
+// Package frpsclient 封装 frps dashboard 的 HTTP API
+package frpsclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 未指定超时时间时单次请求的超时
+const DefaultTimeout = 10 * time.Second
+
+// Config 描述一台 frps 的 dashboard 地址和认证信息
+type Config struct {
+	Name     string
+	Addr     string
+	Port     int
+	User     string
+	Password string
+	TLS      bool
+	Timeout  time.Duration
+
+	// 以下字段只在 TLS 为 true 时生效, 证书和私钥均为 PEM 内容
+	CACert      string
+	Fingerprint string
+	ClientCert  string
+	ClientKey   string
+	Insecure    bool
+}
+
+// BaseURL 返回 dashboard 的根地址, Addr 中已带协议前缀时去掉前缀
+func (cfg Config) BaseURL() string {
+	scheme := "http"
+	if cfg.TLS {
+		scheme = "https"
+	}
+	host := strings.TrimSpace(cfg.Addr)
+	host = strings.TrimPrefix(host, "http://")
+	host = strings.TrimPrefix(host, "https://")
+	host = strings.TrimSuffix(host, "/")
+	return scheme + "://" + net.JoinHostPort(host, strconv.Itoa(cfg.Port))
+}
+
+// Client 访问一台 frps 的 dashboard, 同一台服务器的请求复用连接
+type Client struct {
+	cfg     Config
+	baseURL string
+	// http 用于读取完整响应的请求, 整个请求受 Timeout 限制
+	http *http.Client
+	// stream 用于转发响应流, 只限制等待响应头的时间, 读取响应体的时间由调用方的 context 控制
+	stream *http.Client
+}
+
+// New 创建客户端, TLS 配置无效时返回错误
+func New(cfg Config) (*Client, error) {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		MaxIdleConnsPerHost:   4,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   cfg.Timeout,
+		ResponseHeaderTimeout: cfg.Timeout,
+	}
+	if cfg.TLS {
+		tlsConfig, err := cfg.tlsConfig()
+		if err != nil {
+			return nil, fmt.Errorf("frps [%s] tls config: %w", cfg.Name, err)
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+	return &Client{
+		cfg:     cfg,
+		baseURL: cfg.BaseURL(),
+		http:    &http.Client{Transport: transport, Timeout: cfg.Timeout},
+		stream:  &http.Client{Transport: transport},
+	}, nil
+}
+
+func (c *Client) Config() Config {
+	return c.cfg
+}
+
+// Close 关闭空闲连接
+func (c *Client) Close() {
+	c.http.CloseIdleConnections()
+}
+
+// Get 请求 dashboard 的 api 并返回响应内容, 非 200 响应返回 *StatusError
+func (c *Client) Get(ctx context.Context, api string) ([]byte, error) {
+	return c.do(ctx, http.MethodGet, api)
+}
+
+// Do 发送请求并返回原始响应, 不检查状态码, 调用方负责关闭响应.
+// 响应头需在 Timeout 内返回, 之后读取响应体不受 Timeout 限制, 调用方应通过 ctx 限制转发时间
+func (c *Client) Do(ctx context.Context, method string, api string, body io.Reader, contentType string) (*http.Response, error) {
+	return c.send(c.stream, ctx, method, api, body, contentType)
+}
+
+func (c *Client) send(client *http.Client, ctx context.Context, method string, api string, body io.Reader, contentType string) (*http.Response, error) {
+	requestUrl := c.baseURL + api
+	request, err := http.NewRequestWithContext(ctx, method, requestUrl, body)
+	if err != nil {
+		return nil, &RequestError{Server: c.cfg.Name, URL: requestUrl, Err: err}
+	}
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	if strings.TrimSpace(c.cfg.User) != "" && strings.TrimSpace(c.cfg.Password) != "" {
+		request.SetBasicAuth(c.cfg.User, c.cfg.Password)
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, &RequestError{Server: c.cfg.Name, URL: requestUrl, Err: err}
+	}
+	return response, nil
+}
+
+func (c *Client) do(ctx context.Context, method string, api string) ([]byte, error) {
+	response, err := c.send(c.http, ctx, method, api, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	requestUrl := c.baseURL + api
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, &RequestError{Server: c.cfg.Name, URL: requestUrl, Err: err}
+	}
+	if response.StatusCode != http.StatusOK {
+		return body, &StatusError{Server: c.cfg.Name, URL: requestUrl, StatusCode: response.StatusCode, Body: string(body)}
+	}
+	return body, nil
+}
+
+func (c *Client) getJSON(ctx context.Context, api string, v any) error {
+	body, err := c.Get(ctx, api)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return &DecodeError{Server: c.cfg.Name, URL: c.baseURL + api, Err: err}
+	}
+	return nil
+}
+
+// ServerInfo 查询 /api/serverinfo
+func (c *Client) ServerInfo(ctx context.Context) (*ServerInfo, error) {
+	var info ServerInfo
+	if err := c.getJSON(ctx, "/api/serverinfo", &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Proxies 查询 /api/proxy/<type>
+func (c *Client) Proxies(ctx context.Context, proxyType string) ([]ProxyStats, error) {
+	var resp struct {
+		Proxies []ProxyStats `json:"proxies"`
+	}
+	if err := c.getJSON(ctx, "/api/proxy/"+url.PathEscape(proxyType), &resp); err != nil {
+		return nil, err
+	}
+	return resp.Proxies, nil
+}
+
+// Proxy 查询 /api/proxy/<type>/<name>
+func (c *Client) Proxy(ctx context.Context, proxyType string, name string) (*ProxyStats, error) {
+	var proxy ProxyStats
+	if err := c.getJSON(ctx, "/api/proxy/"+url.PathEscape(proxyType)+"/"+url.PathEscape(name), &proxy); err != nil {
+		return nil, err
+	}
+	return &proxy, nil
+}
+
+// Traffic 查询 /api/traffic/<name>, 返回代理最近几天每天的流量
+func (c *Client) Traffic(ctx context.Context, name string) (*ProxyTraffic, error) {
+	var traffic ProxyTraffic
+	if err := c.getJSON(ctx, "/api/traffic/"+url.PathEscape(name), &traffic); err != nil {
+		return nil, err
+	}
+	return &traffic, nil
+}
+
+// ClearOfflineProxies 删除 frps 上所有离线的代理, 需要 frps v0.53.0 及以上版本
+func (c *Client) ClearOfflineProxies(ctx context.Context) error {
+	_, err := c.do(ctx, http.MethodDelete, "/api/proxies?status=offline")
+	if err != nil && IsUnsupported(err) {
+		return fmt.Errorf("%w: clearing offline proxies requires frps v%s or later", err, ClearOfflineProxiesVersion)
+	}
+	return err
+}
+
+// ClearOfflineProxiesVersion 是支持 DELETE /api/proxies 的最低 frps 版本
+const ClearOfflineProxiesVersion = "0.53.0"
+
+// SupportsClearOfflineProxies 根据 /api/serverinfo 返回的版本判断能否清理离线代理
+func SupportsClearOfflineProxies(version string) bool {
+	return versionAtLeast(version, ClearOfflineProxiesVersion)
+}
+
+// versionAtLeast 比较 x.y.z 格式的版本, 无法解析的版本视为不满足
+func versionAtLeast(version string, min string) bool {
+	current := strings.Split(strings.TrimPrefix(strings.TrimSpace(version), "v"), ".")
+	required := strings.Split(min, ".")
+	for i, part := range required {
+		want, _ := strconv.Atoi(part)
+		if i >= len(current) {
+			return want == 0
+		}
+		// 去掉 -rc1 之类的后缀
+		digits := strings.SplitN(current[i], "-", 2)[0]
+		got, err := strconv.Atoi(digits)
+		if err != nil {
+			return false
+		}
+		if got != want {
+			return got > want
+		}
+	}
+	return true
+}
+
+func (c *Client) String() string {
+	return fmt.Sprintf("frps [%s] %s", c.cfg.Name, c.baseURL)
+}
@@ -0,0 +1,71 @@
+package frpsclient
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// RequestError 表示请求没有得到响应, 例如连接失败或超时
+type RequestError struct {
+	Server string
+	URL    string
+	Err    error
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("request %s failed: %v", e.URL, e.Err)
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// StatusError 表示 dashboard 返回了非 200 的状态码
+type StatusError struct {
+	Server     string
+	URL        string
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	if e.StatusCode == http.StatusNotFound {
+		return fmt.Sprintf("%s error: url not found", e.URL)
+	}
+	return fmt.Sprintf("%s error: %d %s", e.URL, e.StatusCode, e.Body)
+}
+
+// DecodeError 表示响应内容无法解析
+type DecodeError struct {
+	Server string
+	URL    string
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("failed to decode response of %s: %v", e.URL, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// IsNotFound 判断错误是否为 dashboard 返回的 404
+func IsNotFound(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound
+}
+
+// IsUnsupported 判断错误是否表示 frps 版本不支持该 api
+func IsUnsupported(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) &&
+		(statusErr.StatusCode == http.StatusNotFound || statusErr.StatusCode == http.StatusMethodNotAllowed)
+}
+
+// IsUnreachable 判断错误是否为无法连接到 dashboard
+func IsUnreachable(err error) bool {
+	var requestErr *RequestError
+	return errors.As(err, &requestErr)
+}
@@ -0,0 +1,45 @@
+package frpsclient
+
+import "sync"
+
+// Pool 按服务器名称缓存客户端, 服务器配置变化时替换为新的客户端
+type Pool struct {
+	mu      sync.Mutex
+	clients map[string]*Client
+}
+
+func NewPool() *Pool {
+	return &Pool{clients: make(map[string]*Client)}
+}
+
+// Get 返回与 cfg 一致的客户端, 没有时创建
+func (p *Pool) Get(cfg Config) (*Client, error) {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if client, ok := p.clients[cfg.Name]; ok {
+		if client.cfg == cfg {
+			return client, nil
+		}
+		client.Close()
+		delete(p.clients, cfg.Name)
+	}
+	client, err := New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	p.clients[cfg.Name] = client
+	return client, nil
+}
+
+// Remove 删除服务器的客户端
+func (p *Pool) Remove(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if client, ok := p.clients[name]; ok {
+		client.Close()
+		delete(p.clients, name)
+	}
+}
@@ -0,0 +1,92 @@
+package frpsclient
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrFingerprintMismatch 表示 dashboard 证书与固定的指纹不一致
+var ErrFingerprintMismatch = errors.New("dashboard certificate does not match the pinned fingerprint")
+
+// NormalizeFingerprint 把 SHA-256 指纹统一为不带分隔符的小写十六进制
+func NormalizeFingerprint(fingerprint string) (string, error) {
+	fingerprint = strings.ToLower(strings.TrimSpace(fingerprint))
+	fingerprint = strings.TrimPrefix(fingerprint, "sha256:")
+	fingerprint = strings.NewReplacer(":", "", " ", "", "-", "").Replace(fingerprint)
+	if fingerprint == "" {
+		return "", nil
+	}
+	decoded, err := hex.DecodeString(fingerprint)
+	if err != nil || len(decoded) != sha256.Size {
+		return "", fmt.Errorf("invalid sha256 fingerprint")
+	}
+	return fingerprint, nil
+}
+
+// Fingerprint 返回证书的 SHA-256 指纹
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// tlsConfig 根据配置构造 TLS 设置:
+// 配置了 CA 时用 CA 校验证书链, 否则使用系统根证书;
+// 配置了指纹时只要求证书指纹一致 (同时配置 CA 时两者都要满足);
+// 只有显式开启 Insecure 时才跳过校验
+func (cfg Config) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	var roots *x509.CertPool
+	if strings.TrimSpace(cfg.CACert) != "" {
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM([]byte(cfg.CACert)) {
+			return nil, fmt.Errorf("no certificate found in CA bundle")
+		}
+		config.RootCAs = roots
+	}
+
+	if strings.TrimSpace(cfg.ClientCert) != "" || strings.TrimSpace(cfg.ClientKey) != "" {
+		cert, err := tls.X509KeyPair([]byte(cfg.ClientCert), []byte(cfg.ClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	fingerprint, err := NormalizeFingerprint(cfg.Fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case fingerprint != "":
+		// 自行校验, 未配置 CA 时允许自签名证书
+		config.InsecureSkipVerify = true
+		config.VerifyConnection = func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return ErrFingerprintMismatch
+			}
+			leaf := state.PeerCertificates[0]
+			if subtle.ConstantTimeCompare([]byte(Fingerprint(leaf)), []byte(fingerprint)) != 1 {
+				return ErrFingerprintMismatch
+			}
+			if roots == nil {
+				return nil
+			}
+			intermediates := x509.NewCertPool()
+			for _, cert := range state.PeerCertificates[1:] {
+				intermediates.AddCert(cert)
+			}
+			_, err := leaf.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+			return err
+		}
+	case cfg.Insecure:
+		config.InsecureSkipVerify = true
+	}
+	return config, nil
+}
@@ -0,0 +1,69 @@
+package frpsclient
+
+// ServerInfo 是 /api/serverinfo 的响应
+type ServerInfo struct {
+	Version               string           `json:"version"`
+	BindPort              int              `json:"bindPort"`
+	VhostHTTPPort         int              `json:"vhostHTTPPort"`
+	VhostHTTPSPort        int              `json:"vhostHTTPSPort"`
+	TCPMuxHTTPConnectPort int              `json:"tcpmuxHTTPConnectPort"`
+	KCPBindPort           int              `json:"kcpBindPort"`
+	QUICBindPort          int              `json:"quicBindPort"`
+	SubdomainHost         string           `json:"subdomainHost"`
+	MaxPoolCount          int64            `json:"maxPoolCount"`
+	MaxPortsPerClient     int64            `json:"maxPortsPerClient"`
+	HeartBeatTimeout      int64            `json:"heartbeatTimeout"`
+	AllowPortsStr         string           `json:"allowPortsStr,omitempty"`
+	TLSForce              bool             `json:"tlsForce,omitempty"`
+	TotalTrafficIn        int64            `json:"totalTrafficIn"`
+	TotalTrafficOut       int64            `json:"totalTrafficOut"`
+	CurConns              int64            `json:"curConns"`
+	ClientCounts          int64            `json:"clientCounts"`
+	ProxyTypeCounts       map[string]int64 `json:"proxyTypeCount"`
+}
+
+// ProxyCounts 返回所有类型代理的数量之和
+func (info *ServerInfo) ProxyCounts() int64 {
+	var count int64
+	for _, n := range info.ProxyTypeCounts {
+		count += n
+	}
+	return count
+}
+
+// ProxyConf 是代理配置中面板用到的部分
+type ProxyConf struct {
+	Name          string   `json:"name"`
+	Type          string   `json:"type"`
+	RemotePort    int      `json:"remotePort,omitempty"`
+	CustomDomains []string `json:"customDomains,omitempty"`
+	SubDomain     string   `json:"subdomain,omitempty"`
+	Transport     struct {
+		UseEncryption  bool   `json:"useEncryption"`
+		UseCompression bool   `json:"useCompression"`
+		BandwidthLimit string `json:"bandwidthLimit,omitempty"`
+	} `json:"transport"`
+}
+
+// ProxyStats 是 /api/proxy/<type> 中的一个代理
+// User 只有在 frps 返回代理所属用户时才有值, 旧版本需要通过代理名称前缀判断
+type ProxyStats struct {
+	Name            string     `json:"name"`
+	User            string     `json:"user,omitempty"`
+	Type            string     `json:"type,omitempty"`
+	Conf            *ProxyConf `json:"conf"`
+	ClientVersion   string     `json:"clientVersion,omitempty"`
+	TodayTrafficIn  int64      `json:"todayTrafficIn"`
+	TodayTrafficOut int64      `json:"todayTrafficOut"`
+	CurConns        int64      `json:"curConns"`
+	LastStartTime   string     `json:"lastStartTime"`
+	LastCloseTime   string     `json:"lastCloseTime"`
+	Status          string     `json:"status"`
+}
+
+// ProxyTraffic 是 /api/traffic/<name> 的响应, 按天从新到旧排列
+type ProxyTraffic struct {
+	Name       string  `json:"name"`
+	TrafficIn  []int64 `json:"trafficIn"`
+	TrafficOut []int64 `json:"trafficOut"`
+}
@@ -0,0 +1,262 @@
+package controller
+
+import (
+	"encoding/json"
+	"frps-panel/pkg/server/model"
+	"log"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+func ToServerAllocation(userServer model.UserServer) (ServerAllocation, error) {
+	allocation := ServerAllocation{
+		Server: userServer.Server,
+	}
+	if userServer.Ports != "" {
+		if err := json.Unmarshal([]byte(userServer.Ports), &allocation.Ports); err != nil {
+			return allocation, err
+		}
+	}
+	if userServer.Domains != "" {
+		if err := json.Unmarshal([]byte(userServer.Domains), &allocation.Domains); err != nil {
+			return allocation, err
+		}
+	}
+	if userServer.Subdomains != "" {
+		if err := json.Unmarshal([]byte(userServer.Subdomains), &allocation.Subdomains); err != nil {
+			return allocation, err
+		}
+	}
+	return allocation, nil
+}
+
+func FromServerAllocation(user string, allocation ServerAllocation) (model.UserServer, error) {
+	userServer := model.UserServer{
+		User:   user,
+		Server: allocation.Server,
+	}
+	ports, err := json.Marshal(allocation.Ports)
+	if err != nil {
+		return userServer, err
+	}
+	userServer.Ports = string(ports)
+
+	domains, err := json.Marshal(allocation.Domains)
+	if err != nil {
+		return userServer, err
+	}
+	userServer.Domains = string(domains)
+
+	subdomains, err := json.Marshal(allocation.Subdomains)
+	if err != nil {
+		return userServer, err
+	}
+	userServer.Subdomains = string(subdomains)
+
+	return userServer, nil
+}
+
+// allocationFor 返回用户在指定服务器上的分配, 未分配任何服务器的用户使用自身的限制且不限服务器
+func (info UserTokenInfo) allocationFor(server string) (ServerAllocation, bool) {
+	if len(info.Servers) == 0 {
+		return ServerAllocation{
+			Ports:      info.Ports,
+			Domains:    info.Domains,
+			Subdomains: info.Subdomains,
+		}, true
+	}
+	for _, allocation := range info.Servers {
+		if allocation.Server == server {
+			return allocation, true
+		}
+	}
+	return ServerAllocation{}, false
+}
+
+// serverNames 返回用户被分配的所有服务器名称
+func (info UserTokenInfo) serverNames() []string {
+	var names []string
+	for _, allocation := range info.Servers {
+		names = append(names, allocation.Server)
+	}
+	return names
+}
+
+// normalizeAllocations 清理分配信息, 并让顶层的 server/ports/domains/subdomains 与首个分配保持一致
+func normalizeAllocations(info *UserTokenInfo) {
+	if len(info.Servers) == 0 && info.Server != "" {
+		info.Servers = []ServerAllocation{{
+			Server:     info.Server,
+			Ports:      info.Ports,
+			Domains:    info.Domains,
+			Subdomains: info.Subdomains,
+		}}
+	}
+	for i := range info.Servers {
+		info.Servers[i].Server = cleanString(info.Servers[i].Server)
+		info.Servers[i].Ports = cleanPorts(info.Servers[i].Ports)
+		info.Servers[i].Domains = cleanStrings(info.Servers[i].Domains)
+		info.Servers[i].Subdomains = cleanStrings(info.Servers[i].Subdomains)
+	}
+	if len(info.Servers) > 0 {
+		primary := info.Servers[0]
+		info.Server = primary.Server
+		info.Ports = primary.Ports
+		info.Domains = primary.Domains
+		info.Subdomains = primary.Subdomains
+	}
+}
+
+// syncPrimaryAllocation 将表格中对顶层字段的修改同步到对应服务器的分配中, 直接修改了分配列表时以分配列表为准
+func syncPrimaryAllocation(before UserTokenInfo, after *UserTokenInfo) {
+	if !reflect.DeepEqual(before.Servers, after.Servers) {
+		return
+	}
+	primary := ServerAllocation{
+		Server:     after.Server,
+		Ports:      after.Ports,
+		Domains:    after.Domains,
+		Subdomains: after.Subdomains,
+	}
+	for i, allocation := range after.Servers {
+		if allocation.Server == before.Server {
+			after.Servers[i] = primary
+			return
+		}
+	}
+	if after.Server != "" {
+		after.Servers = append([]ServerAllocation{primary}, after.Servers...)
+	}
+}
+
+// queryUserTokenInfo 查询用户信息及其服务器分配
+func (c *HandleController) queryUserTokenInfo(user string) (UserTokenInfo, error) {
+	if info, ok := c.userCache.Get(user); ok {
+		return info, nil
+	}
+	generation := c.userCache.Generation()
+	var userToken model.UserToken
+	if result := c.DB.Where("user = ?", user).First(&userToken); result.Error != nil {
+		return UserTokenInfo{}, result.Error
+	}
+	info, err := ToUserTokenInfo(userToken)
+	if err != nil {
+		return info, err
+	}
+	if err := c.loadAllocations(&info); err != nil {
+		return info, err
+	}
+	c.userCache.Set(user, info, generation)
+	return info, nil
+}
+
+// loadAllocations 从数据库加载用户的服务器分配
+func (c *HandleController) loadAllocations(info *UserTokenInfo) error {
+	return loadAllocationsFrom(c.DB, info)
+}
+
+// loadAllocationsFrom 使用指定的连接 (可以是事务) 加载用户的服务器分配
+func loadAllocationsFrom(db *gorm.DB, info *UserTokenInfo) error {
+	var userServers []model.UserServer
+	if result := db.Where("user = ?", info.User).Order("id").Find(&userServers); result.Error != nil {
+		return result.Error
+	}
+	info.Servers = nil
+	for _, userServer := range userServers {
+		allocation, err := ToServerAllocation(userServer)
+		if err != nil {
+			return err
+		}
+		info.Servers = append(info.Servers, allocation)
+	}
+	return nil
+}
+
+// loadStoredUserTokenInfo 在事务中读取数据库里的用户及其服务器分配, 用户不存在时 found 为 false
+func loadStoredUserTokenInfo(tx *gorm.DB, user string) (info UserTokenInfo, found bool, err error) {
+	var userTokens []model.UserToken
+	if result := tx.Where("user = ?", user).Limit(1).Find(&userTokens); result.Error != nil {
+		return info, false, result.Error
+	}
+	if len(userTokens) == 0 {
+		return info, false, nil
+	}
+	if info, err = ToUserTokenInfo(userTokens[0]); err != nil {
+		return info, false, err
+	}
+	return info, true, loadAllocationsFrom(tx, &info)
+}
+
+// saveAllocations 用 info.Servers 替换用户在数据库中的服务器分配
+func saveAllocations(tx *gorm.DB, info UserTokenInfo) error {
+	if result := tx.Unscoped().Where("user = ?", info.User).Delete(&model.UserServer{}); result.Error != nil {
+		return result.Error
+	}
+	for _, allocation := range info.Servers {
+		userServer, err := FromServerAllocation(info.User, allocation)
+		if err != nil {
+			return err
+		}
+		if result := tx.Create(&userServer); result.Error != nil {
+			return result.Error
+		}
+	}
+	return nil
+}
+
+// MigrateUserServers 为仍只使用 user_tokens.server 字段的旧用户生成服务器分配
+func MigrateUserServers(db *gorm.DB) error {
+	var userTokens []model.UserToken
+	if result := db.Where("server <> ''").Find(&userTokens); result.Error != nil {
+		return result.Error
+	}
+	for _, userToken := range userTokens {
+		var count int64
+		db.Model(&model.UserServer{}).Where("user = ?", userToken.User).Count(&count)
+		if count > 0 {
+			continue
+		}
+		userServer := model.UserServer{
+			User:       userToken.User,
+			Server:     userToken.Server,
+			Ports:      userToken.Ports,
+			Domains:    userToken.Domains,
+			Subdomains: userToken.Subdomains,
+		}
+		if result := db.Create(&userServer); result.Error != nil {
+			return result.Error
+		}
+		log.Printf("migrated user [%s] to server [%s] allocation", userToken.User, userToken.Server)
+	}
+	return nil
+}
+
+// maxAllocatedPort 返回端口列表中最大的端口号
+func maxAllocatedPort(ports []any) int {
+	maxPort := 0
+	for _, p := range ports {
+		switch v := p.(type) {
+		case int:
+			maxPort = max(maxPort, v)
+		case float64:
+			maxPort = max(maxPort, int(v))
+		case string:
+			parts := strings.Split(v, "-")
+			if len(parts) == 2 {
+				endPort, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+				if err == nil {
+					maxPort = max(maxPort, endPort)
+				}
+			} else {
+				singlePort, err := strconv.Atoi(strings.TrimSpace(v))
+				if err == nil {
+					maxPort = max(maxPort, singlePort)
+				}
+			}
+		}
+	}
+	return maxPort
+}
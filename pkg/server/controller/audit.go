@@ -0,0 +1,207 @@
+package controller
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"frps-panel/pkg/server/model"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 管理员操作类型
+const (
+	AuditUserAdd          = "user.add"
+	AuditUserUpdate       = "user.update"
+	AuditUserRemove       = "user.remove"
+	AuditUserEnable       = "user.enable"
+	AuditUserDisable      = "user.disable"
+	AuditTemplateSave     = "template.save"
+	AuditTemplateRollback = "template.rollback"
+	AuditDashboardSwitch  = "dashboard.switch"
+	AuditPluginKeyRotate  = "dashboard.rotate_plugin_key"
+	AuditDashboardSave    = "dashboard.save"
+	AuditUserKick         = "user.kick"
+	AuditUserUnkick       = "user.unkick"
+	AuditProxiesClear     = "dashboard.clear_offline"
+	AuditQuotaTopUp       = "user.quota_topup"
+	AuditTokenRotate      = "user.rotate_token"
+	auditExportMaxRecords = 100000
+)
+
+// currentActor 返回当前操作的管理员账号, 未配置管理员时返回 anonymous
+func currentActor(context *gin.Context) string {
+	session := sessions.Default(context)
+	if auth := session.Get(AuthName); auth != nil {
+		if username, _, ok := parseBasicAuth(fmt.Sprintf("%v", auth)); ok && username != "" {
+			return username
+		}
+	}
+	return "anonymous"
+}
+
+// recordAudit 保存一条管理员操作记录, 保存失败只记录日志, 不影响操作本身
+func (c *HandleController) recordAudit(context *gin.Context, action string, target string, payload any) {
+	if c.DB == nil {
+		return
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		data = []byte(fmt.Sprintf("%q", fmt.Sprint(payload)))
+	}
+	audit := model.AdminAudit{
+		Actor:    currentActor(context),
+		Action:   action,
+		Target:   target,
+		SourceIP: context.ClientIP(),
+		Payload:  string(data),
+	}
+	if result := c.DB.Create(&audit); result.Error != nil {
+		log.Printf("failed to save admin audit [%s] of [%s]: %v", action, target, result.Error)
+	}
+}
+
+// diffUserTokenInfo 返回修改前后发生变化的字段
+func diffUserTokenInfo(before UserTokenInfo, after UserTokenInfo) map[string]any {
+	beforeFields, afterFields := auditUserTokenInfo(before), auditUserTokenInfo(after)
+	diff := make(map[string]any)
+	for field, afterValue := range afterFields {
+		if beforeValue := beforeFields[field]; !reflect.DeepEqual(beforeValue, afterValue) {
+			diff[field] = gin.H{"before": beforeValue, "after": afterValue}
+		}
+	}
+	// token 同时是面板登录密码, 只记录是否修改
+	if before.Token != after.Token {
+		diff["token_changed"] = true
+	}
+	return diff
+}
+
+// auditUserTokenInfo 返回写入审计记录的用户信息, 不包含 token
+func auditUserTokenInfo(info UserTokenInfo) map[string]any {
+	fields := make(map[string]any)
+	data, _ := json.Marshal(info)
+	_ = json.Unmarshal(data, &fields)
+	delete(fields, "token")
+	return fields
+}
+
+// adminAuditQuery 按请求参数过滤管理员操作记录
+func (c *HandleController) adminAuditQuery(context *gin.Context) *gorm.DB {
+	query := c.DB.Model(&model.AdminAudit{})
+	if actor := trimString(context.Query("actor")); actor != "" {
+		query = query.Where("actor = ?", actor)
+	}
+	if action := trimString(context.Query("action")); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if target := trimString(context.Query("target")); target != "" {
+		query = query.Where("target LIKE ?", "%"+target+"%")
+	}
+	if start := trimString(context.Query("start")); start != "" {
+		query = query.Where("created_at >= ?", start)
+	}
+	if end := trimString(context.Query("end")); end != "" {
+		query = query.Where("created_at <= ?", end)
+	}
+	return query
+}
+
+type AdminAuditInfo struct {
+	Id       uint   `json:"id"`
+	Time     string `json:"time"`
+	Actor    string `json:"actor"`
+	Action   string `json:"action"`
+	Target   string `json:"target"`
+	SourceIP string `json:"source_ip"`
+	Payload  string `json:"payload"`
+}
+
+func toAdminAuditInfo(audit model.AdminAudit) AdminAuditInfo {
+	return AdminAuditInfo{
+		Id:       audit.ID,
+		Time:     audit.CreatedAt.Format("2006-01-02 15:04:05"),
+		Actor:    audit.Actor,
+		Action:   audit.Action,
+		Target:   audit.Target,
+		SourceIP: audit.SourceIP,
+		Payload:  audit.Payload,
+	}
+}
+
+// 查询管理员操作记录
+func (c *HandleController) MakeQueryAdminAuditsFunc() func(context *gin.Context) {
+	return func(context *gin.Context) {
+		query := c.adminAuditQuery(context)
+
+		var count int64
+		query.Count(&count)
+
+		page, _ := strconv.Atoi(context.DefaultQuery("page", "1"))
+		limit, _ := strconv.Atoi(context.DefaultQuery("limit", "20"))
+		if page < 1 {
+			page = 1
+		}
+		if limit < 1 || limit > 1000 {
+			limit = 20
+		}
+
+		var audits []model.AdminAudit
+		if result := query.Order("id desc").Offset((page - 1) * limit).Limit(limit).Find(&audits); result.Error != nil {
+			context.JSON(http.StatusInternalServerError, gin.H{
+				"code": SaveError,
+				"msg":  "Failed to query admin audits: " + result.Error.Error(),
+			})
+			return
+		}
+
+		data := make([]AdminAuditInfo, 0, len(audits))
+		for _, audit := range audits {
+			data = append(data, toAdminAuditInfo(audit))
+		}
+
+		context.JSON(http.StatusOK, gin.H{
+			"code":  0,
+			"msg":   "query admin audits success",
+			"count": count,
+			"data":  data,
+		})
+	}
+}
+
+// 导出管理员操作记录为 CSV
+func (c *HandleController) MakeExportAdminAuditsFunc() func(context *gin.Context) {
+	return func(context *gin.Context) {
+		var audits []model.AdminAudit
+		if result := c.adminAuditQuery(context).Order("id desc").Limit(auditExportMaxRecords).Find(&audits); result.Error != nil {
+			context.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "Failed to query admin audits: " + result.Error.Error(),
+			})
+			return
+		}
+
+		filename := fmt.Sprintf("admin-audits-%s.csv", time.Now().Format("20060102150405"))
+		context.Header("Content-Type", "text/csv; charset=utf-8")
+		context.Header("Content-Disposition", "attachment; filename="+filename)
+		// 写入 BOM, 方便 Excel 正确识别中文
+		_, _ = context.Writer.Write([]byte("\xEF\xBB\xBF"))
+
+		writer := csv.NewWriter(context.Writer)
+		_ = writer.Write([]string{"id", "time", "actor", "action", "target", "source_ip", "payload"})
+		for _, audit := range audits {
+			info := toAdminAuditInfo(audit)
+			_ = writer.Write([]string{
+				strconv.FormatUint(uint64(info.Id), 10), info.Time, info.Actor, info.Action, info.Target, info.SourceIP, info.Payload,
+			})
+		}
+		writer.Flush()
+	}
+}
@@ -0,0 +1,239 @@
+package controller
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 未配置 user_cache_ttl 时的缓存时间
+const defaultUserCacheTTL = 30 * time.Second
+
+type userCacheEntry struct {
+	info    UserTokenInfo
+	expires time.Time
+}
+
+// subdomainOwner 是拥有子域名的用户, Server 为空表示未分配服务器的用户, 视为使用所有服务器
+type subdomainOwner struct {
+	User   string
+	Server string
+}
+
+// subdomainIndex 是所有用户分配和自助申请的子域名, 插件检查子域名时不必逐个查询用户
+type subdomainIndex struct {
+	owners  map[string][]subdomainOwner // 小写的子域名 -> 拥有者
+	claims  map[subdomainOwner][]string // 用户在服务器上自助申请的子域名
+	expires time.Time
+}
+
+// userCache 缓存插件热路径上的用户信息及其服务器分配, 用户被修改时需要显式失效
+type userCache struct {
+	mu         sync.RWMutex
+	ttl        time.Duration
+	entries    map[string]userCacheEntry
+	subdomains *subdomainIndex
+	// generation 在每次失效时递增, 查询数据库前记录, 写入时不一致说明读到的数据可能已过期
+	generation uint64
+
+	hits          atomic.Uint64
+	misses        atomic.Uint64
+	invalidations atomic.Uint64
+}
+
+// cacheTTL 将配置的秒数转换为缓存时间, 0 使用默认值, 负数表示不缓存
+func cacheTTL(ttlSeconds int) time.Duration {
+	if ttlSeconds > 0 {
+		return time.Duration(ttlSeconds) * time.Second
+	} else if ttlSeconds < 0 {
+		return 0
+	}
+	return defaultUserCacheTTL
+}
+
+// newUserCache 根据配置的秒数创建缓存
+func newUserCache(ttlSeconds int) *userCache {
+	return &userCache{
+		ttl:     cacheTTL(ttlSeconds),
+		entries: make(map[string]userCacheEntry),
+	}
+}
+
+func (uc *userCache) Get(user string) (UserTokenInfo, bool) {
+	if uc == nil || uc.ttl <= 0 {
+		return UserTokenInfo{}, false
+	}
+	uc.mu.RLock()
+	entry, ok := uc.entries[user]
+	uc.mu.RUnlock()
+	if !ok || time.Now().After(entry.expires) {
+		uc.misses.Add(1)
+		return UserTokenInfo{}, false
+	}
+	uc.hits.Add(1)
+	return entry.info, true
+}
+
+// Generation 返回当前的失效代数, 需要在查询数据库之前获取并传给 Set
+func (uc *userCache) Generation() uint64 {
+	if uc == nil {
+		return 0
+	}
+	uc.mu.RLock()
+	defer uc.mu.RUnlock()
+	return uc.generation
+}
+
+// Set 缓存查询到的用户信息, 查询期间发生过失效时丢弃, 避免旧数据被重新缓存
+func (uc *userCache) Set(user string, info UserTokenInfo, generation uint64) {
+	if uc == nil || uc.ttl <= 0 {
+		return
+	}
+	uc.mu.Lock()
+	if uc.generation == generation {
+		uc.entries[user] = userCacheEntry{info: info, expires: time.Now().Add(uc.ttl)}
+	}
+	uc.mu.Unlock()
+}
+
+// Subdomains 返回缓存的子域名索引, 任何用户失效时都会重建
+func (uc *userCache) Subdomains() (*subdomainIndex, bool) {
+	if uc == nil || uc.ttl <= 0 {
+		return nil, false
+	}
+	uc.mu.RLock()
+	index := uc.subdomains
+	uc.mu.RUnlock()
+	if index == nil || time.Now().After(index.expires) {
+		return nil, false
+	}
+	return index, true
+}
+
+func (uc *userCache) SetSubdomains(index *subdomainIndex, generation uint64) {
+	if uc == nil || uc.ttl <= 0 {
+		return
+	}
+	index.expires = time.Now().Add(uc.ttl)
+	uc.mu.Lock()
+	if uc.generation == generation {
+		uc.subdomains = index
+	}
+	uc.mu.Unlock()
+}
+
+// Invalidate 删除指定用户的缓存, 不传用户时清空所有缓存
+func (uc *userCache) Invalidate(users ...string) {
+	if uc == nil {
+		return
+	}
+	uc.mu.Lock()
+	uc.generation++
+	uc.subdomains = nil
+	if len(users) == 0 {
+		uc.entries = make(map[string]userCacheEntry)
+	}
+	for _, user := range users {
+		delete(uc.entries, user)
+	}
+	uc.mu.Unlock()
+	uc.invalidations.Add(1)
+}
+
+// Stats 返回缓存的命中统计
+func (uc *userCache) Stats() gin.H {
+	if uc == nil {
+		return gin.H{"enabled": false}
+	}
+	uc.mu.Lock()
+	now := time.Now()
+	for user, entry := range uc.entries {
+		if now.After(entry.expires) {
+			delete(uc.entries, user)
+		}
+	}
+	size := len(uc.entries)
+	uc.mu.Unlock()
+
+	hits, misses := uc.hits.Load(), uc.misses.Load()
+	hitRate := 0.0
+	if hits+misses > 0 {
+		hitRate = float64(hits) / float64(hits+misses)
+	}
+	return gin.H{
+		"enabled":       uc.ttl > 0,
+		"ttl_seconds":   int(uc.ttl / time.Second),
+		"size":          size,
+		"hits":          hits,
+		"misses":        misses,
+		"hit_rate":      hitRate,
+		"invalidations": uc.invalidations.Load(),
+	}
+}
+
+// 查询用户缓存的统计信息
+func (c *HandleController) MakeCacheStatsFunc() func(context *gin.Context) {
+	return func(context *gin.Context) {
+		context.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "query cache stats success",
+			"data":    c.userCache.Stats(),
+		})
+	}
+}
+
+type pluginServerEntry struct {
+	server  *ServerInfo // nil 表示没有匹配的服务器, 避免未知的调用方每次都查询数据库
+	expires time.Time
+}
+
+// pluginServerCache 缓存插件请求识别出的服务器, 插件密钥或 dashboard 地址修改时需要显式失效
+type pluginServerCache struct {
+	mu      sync.RWMutex
+	ttl     time.Duration
+	entries map[string]pluginServerEntry
+}
+
+// newPluginServerCache 与用户缓存使用相同的缓存时间
+func newPluginServerCache(ttlSeconds int) *pluginServerCache {
+	return &pluginServerCache{
+		ttl:     cacheTTL(ttlSeconds),
+		entries: make(map[string]pluginServerEntry),
+	}
+}
+
+// Get 返回缓存的查询结果, ok 为 true 且 server 为 nil 表示已知没有匹配的服务器
+func (sc *pluginServerCache) Get(key string) (server *ServerInfo, ok bool) {
+	if sc == nil || sc.ttl <= 0 {
+		return nil, false
+	}
+	sc.mu.RLock()
+	entry, ok := sc.entries[key]
+	sc.mu.RUnlock()
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.server, true
+}
+
+func (sc *pluginServerCache) Set(key string, server *ServerInfo) {
+	if sc == nil || sc.ttl <= 0 {
+		return
+	}
+	sc.mu.Lock()
+	sc.entries[key] = pluginServerEntry{server: server, expires: time.Now().Add(sc.ttl)}
+	sc.mu.Unlock()
+}
+
+// Invalidate 清空所有缓存的服务器
+func (sc *pluginServerCache) Invalidate() {
+	if sc == nil {
+		return
+	}
+	sc.mu.Lock()
+	sc.entries = make(map[string]pluginServerEntry)
+	sc.mu.Unlock()
+}
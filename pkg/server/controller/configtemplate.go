@@ -0,0 +1,409 @@
+package controller
+
+import (
+	"fmt"
+	"frps-panel/pkg/server/model"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 默认模板的 server 为空, 服务器的模板为空时使用默认模板, 都没有保存过时使用内置的 config_template.json
+const (
+	defaultTemplateServer = ""
+	// 超过该行数的模板不计算差异
+	templateDiffMaxLines = 2000
+)
+
+// 保存模板前用于校验的示例用户
+var sampleFrpcConfigData = FrpcConfigData{
+	Server:        "sample",
+	ServerAddr:    "frps.example.com",
+	ServerPort:    defaultFrpsBindPort,
+	User:          "sample",
+	Token:         "sample-token",
+	Ports:         []string{"6000", "6001-6010"},
+	Port:          6000,
+	Domains:       []string{"web.example.com"},
+	Subdomains:    []string{"web"},
+	SubdomainHost: "example.com",
+	ProxyName:     "Sample01",
+}
+
+type ConfigTemplateInfo struct {
+	Id       uint   `json:"id"`
+	Server   string `json:"server"`
+	Version  int    `json:"version"`
+	Template string `json:"template"`
+	Inherit  bool   `json:"inherit"`
+	Author   string `json:"author"`
+	Comment  string `json:"comment"`
+	Time     string `json:"time"`
+}
+
+func toConfigTemplateInfo(t model.ConfigTemplate) ConfigTemplateInfo {
+	return ConfigTemplateInfo{
+		Id:       t.ID,
+		Server:   t.Server,
+		Version:  t.Version,
+		Template: t.Template,
+		Inherit:  t.Server != defaultTemplateServer && t.Template == "",
+		Author:   t.Author,
+		Comment:  t.Comment,
+		Time:     t.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+}
+
+// latestConfigTemplate 返回服务器模板的最新版本, 没有保存过时返回 false
+func (c *HandleController) latestConfigTemplate(server string) (model.ConfigTemplate, bool, error) {
+	var t model.ConfigTemplate
+	result := c.DB.Where("server = ?", server).Order("version desc").Limit(1).Find(&t)
+	return t, result.RowsAffected > 0, result.Error
+}
+
+// configTemplateFor 返回渲染服务器 frpc 配置使用的模板
+func (c *HandleController) configTemplateFor(server string) (string, error) {
+	if server != defaultTemplateServer {
+		t, ok, err := c.latestConfigTemplate(server)
+		if err != nil {
+			return "", err
+		}
+		if ok && t.Template != "" {
+			return t.Template, nil
+		}
+	}
+	t, ok, err := c.latestConfigTemplate(defaultTemplateServer)
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		return t.Template, nil
+	}
+	return c.loadConfigTemplate()
+}
+
+// templateError 是模板没有通过校验的原因, Line 为模板中的行号, 0 表示无法定位, Rendered 为示例用户生成的配置
+type templateError struct {
+	Line     int
+	Rendered string
+	Err      error
+}
+
+func (e *templateError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("template line %d: %v", e.Line, e.Err)
+	}
+	return e.Err.Error()
+}
+
+// validateConfigTemplate 使用示例用户渲染模板, 所有格式都能生成并通过 frp 的校验时才允许保存
+func validateConfigTemplate(text string) *templateError {
+	for _, format := range []string{FrpcFormatToml, FrpcFormatYaml, FrpcFormatJson, FrpcFormatIni} {
+		content, err := RenderFrpcConfig(text, sampleFrpcConfigData, format)
+		if err == nil {
+			err = ValidateFrpcConfig(content, format)
+		}
+		if err != nil {
+			return &templateError{Line: templateLineOf(text, content, err), Rendered: string(content), Err: err}
+		}
+	}
+	return nil
+}
+
+// saveConfigTemplateVersion 保存为服务器模板的新版本
+func (c *HandleController) saveConfigTemplateVersion(context *gin.Context, server string, text string, comment string) (model.ConfigTemplate, error) {
+	t := model.ConfigTemplate{
+		Server:   server,
+		Template: text,
+		Author:   currentActor(context),
+		Comment:  comment,
+	}
+	err := c.DB.Transaction(func(tx *gorm.DB) error {
+		var latest model.ConfigTemplate
+		if result := tx.Where("server = ?", server).Order("version desc").Limit(1).Find(&latest); result.Error != nil {
+			return result.Error
+		}
+		t.Version = latest.Version + 1
+		return tx.Create(&t).Error
+	})
+	return t, err
+}
+
+func (c *HandleController) templateServerExists(server string) bool {
+	if server == defaultTemplateServer {
+		return true
+	}
+	var count int64
+	c.DB.Model(&model.ServerInfo{}).Where("name = ?", server).Count(&count)
+	return count > 0
+}
+
+// 查询服务器当前的模板, 服务器没有单独的模板时返回默认模板
+func (c *HandleController) MakeQueryConfigTemplateFunc() func(context *gin.Context) {
+	return func(context *gin.Context) {
+		server := trimString(context.Query("server"))
+		t, ok, err := c.latestConfigTemplate(server)
+		if err != nil {
+			context.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "Failed to query config template: " + err.Error(),
+			})
+			return
+		}
+		info := toConfigTemplateInfo(t)
+		info.Server = server
+		if !ok {
+			info.Inherit = server != defaultTemplateServer
+		}
+		if info.Template == "" {
+			if info.Template, err = c.configTemplateFor(defaultTemplateServer); err != nil {
+				context.JSON(http.StatusInternalServerError, gin.H{
+					"success": false,
+					"message": "Failed to load default config template: " + err.Error(),
+				})
+				return
+			}
+		}
+		context.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    info,
+		})
+	}
+}
+
+// 查询服务器模板的历史版本
+func (c *HandleController) MakeQueryConfigTemplateVersionsFunc() func(context *gin.Context) {
+	return func(context *gin.Context) {
+		server := trimString(context.Query("server"))
+		var templates []model.ConfigTemplate
+		if result := c.DB.Where("server = ?", server).Order("version desc").Find(&templates); result.Error != nil {
+			context.JSON(http.StatusInternalServerError, gin.H{
+				"code": SaveError,
+				"msg":  "Failed to query config templates: " + result.Error.Error(),
+			})
+			return
+		}
+		data := make([]ConfigTemplateInfo, 0, len(templates))
+		for _, t := range templates {
+			data = append(data, toConfigTemplateInfo(t))
+		}
+		context.JSON(http.StatusOK, gin.H{
+			"code":  0,
+			"msg":   "query config templates success",
+			"count": len(data),
+			"data":  data,
+		})
+	}
+}
+
+// 保存模板为新版本, server 为空时保存默认模板, 服务器的模板为空时恢复使用默认模板
+func (c *HandleController) MakeSaveConfigTemplateFunc() func(context *gin.Context) {
+	return func(context *gin.Context) {
+		var req struct {
+			Server   string `json:"server"`
+			Template string `json:"template"`
+			Comment  string `json:"comment"`
+		}
+		if err := context.BindJSON(&req); err != nil {
+			context.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Invalid request body",
+			})
+			return
+		}
+		req.Server = trimString(req.Server)
+		if strings.TrimSpace(req.Template) == "" {
+			if req.Server == defaultTemplateServer {
+				context.JSON(http.StatusOK, gin.H{
+					"success": false,
+					"message": "Default config template can not be empty",
+				})
+				return
+			}
+			req.Template = ""
+		} else if err := validateConfigTemplate(req.Template); err != nil {
+			context.JSON(http.StatusOK, gin.H{
+				"success":  false,
+				"message":  "Config template is invalid for a sample user: " + err.Error(),
+				"line":     err.Line,
+				"rendered": err.Rendered,
+			})
+			return
+		}
+		if !c.templateServerExists(req.Server) {
+			context.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("server [%s] not found", req.Server),
+			})
+			return
+		}
+
+		t, err := c.saveConfigTemplateVersion(context, req.Server, req.Template, trimString(req.Comment))
+		if err != nil {
+			context.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "Failed to save config template: " + err.Error(),
+			})
+			return
+		}
+		c.recordAudit(context, AuditTemplateSave, "config_template", gin.H{"server": req.Server, "version": t.Version, "comment": t.Comment, "template": req.Template})
+		context.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "Config template saved successfully",
+			"version": t.Version,
+		})
+	}
+}
+
+// 回滚到历史版本, 历史版本的内容保存为新版本
+func (c *HandleController) MakeRollbackConfigTemplateFunc() func(context *gin.Context) {
+	return func(context *gin.Context) {
+		var req struct {
+			Server  string `json:"server"`
+			Version int    `json:"version"`
+		}
+		if err := context.BindJSON(&req); err != nil || req.Version < 1 {
+			context.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Invalid request body",
+			})
+			return
+		}
+		req.Server = trimString(req.Server)
+
+		var target model.ConfigTemplate
+		if result := c.DB.Where("server = ? AND version = ?", req.Server, req.Version).Limit(1).Find(&target); result.Error != nil || result.RowsAffected == 0 {
+			context.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("version %d of config template [%s] not found", req.Version, req.Server),
+			})
+			return
+		}
+		// 历史版本可能早于模板校验, 回滚前同样需要通过校验, 空模板表示使用默认模板
+		if strings.TrimSpace(target.Template) != "" {
+			if err := validateConfigTemplate(target.Template); err != nil {
+				context.JSON(http.StatusOK, gin.H{
+					"success":  false,
+					"message":  fmt.Sprintf("Version %d is invalid for a sample user: %s", req.Version, err.Error()),
+					"line":     err.Line,
+					"rendered": err.Rendered,
+					"template": target.Template,
+				})
+				return
+			}
+		}
+		t, err := c.saveConfigTemplateVersion(context, req.Server, target.Template, fmt.Sprintf("rollback to version %d", req.Version))
+		if err != nil {
+			context.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "Failed to rollback config template: " + err.Error(),
+			})
+			return
+		}
+		c.recordAudit(context, AuditTemplateRollback, "config_template", gin.H{"server": req.Server, "from": req.Version, "version": t.Version})
+		context.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "Config template rolled back successfully",
+			"version": t.Version,
+		})
+	}
+}
+
+// 比较服务器模板的两个版本, to 为空时与最新版本比较
+func (c *HandleController) MakeDiffConfigTemplateFunc() func(context *gin.Context) {
+	return func(context *gin.Context) {
+		server := trimString(context.Query("server"))
+		from, err := strconv.Atoi(context.Query("from"))
+		if err != nil {
+			context.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "from is required",
+			})
+			return
+		}
+		to, _ := strconv.Atoi(context.DefaultQuery("to", "0"))
+
+		fromTemplate, err := c.configTemplateVersion(server, from)
+		if err == nil && to == 0 {
+			var latest model.ConfigTemplate
+			latest, _, err = c.latestConfigTemplate(server)
+			to = latest.Version
+		}
+		var toTemplate model.ConfigTemplate
+		if err == nil {
+			toTemplate, err = c.configTemplateVersion(server, to)
+		}
+		if err != nil {
+			context.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		context.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"from":    from,
+			"to":      to,
+			"diff":    lineDiff(fromTemplate.Template, toTemplate.Template, fmt.Sprintf("version %d", from), fmt.Sprintf("version %d", to)),
+		})
+	}
+}
+
+func (c *HandleController) configTemplateVersion(server string, version int) (model.ConfigTemplate, error) {
+	var t model.ConfigTemplate
+	result := c.DB.Where("server = ? AND version = ?", server, version).Limit(1).Find(&t)
+	if result.Error != nil {
+		return t, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return t, fmt.Errorf("version %d of config template [%s] not found", version, server)
+	}
+	return t, nil
+}
+
+// lineDiff 按行比较两个模板, 返回带完整上下文的 unified 格式差异
+func lineDiff(from string, to string, fromName string, toName string) string {
+	a := strings.Split(from, "\n")
+	b := strings.Split(to, "\n")
+	var out strings.Builder
+	out.WriteString("--- " + fromName + "\n+++ " + toName + "\n")
+	if len(a) > templateDiffMaxLines || len(b) > templateDiffMaxLines {
+		out.WriteString("# template too large to diff\n")
+		return out.String()
+	}
+
+	// lcs[i][j] 为 a[i:] 和 b[j:] 的最长公共子序列长度
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			out.WriteString(" " + a[i] + "\n")
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			out.WriteString("+" + b[j] + "\n")
+			j++
+		default:
+			out.WriteString("-" + a[i] + "\n")
+			i++
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,122 @@
+package controller
+
+import (
+	"frps-panel/pkg/server/model"
+	"strings"
+)
+
+// 域名规则:
+//   - example.com    仅匹配 example.com
+//   - *.example.com  匹配 example.com 的任意下级域名, 不含 example.com 本身
+//   - .example.com   匹配 example.com 及其任意下级域名
+
+// validDomainRule 判断域名规则格式是否合法
+func validDomainRule(rule string) bool {
+	if strings.HasPrefix(rule, "*.") {
+		return domainFormat.MatchString(rule[2:])
+	}
+	if strings.HasPrefix(rule, ".") {
+		return domainFormat.MatchString(rule[1:])
+	}
+	return domainFormat.MatchString(rule)
+}
+
+// domainRuleBase 返回规则的基础域名以及规则是否为通配符或后缀规则
+func domainRuleBase(rule string) (string, bool) {
+	rule = strings.ToLower(trimString(rule))
+	if strings.HasPrefix(rule, "*.") {
+		return rule[2:], true
+	}
+	if strings.HasPrefix(rule, ".") {
+		return rule[1:], true
+	}
+	return rule, false
+}
+
+func isSubdomainOf(domain, base string) bool {
+	return strings.HasSuffix(domain, "."+base)
+}
+
+// matchDomainRule 判断域名是否符合规则
+func matchDomainRule(rule, domain string) bool {
+	domain = strings.ToLower(trimString(domain))
+	base, pattern := domainRuleBase(rule)
+	if !pattern {
+		return domain == base
+	}
+	if strings.HasPrefix(trimString(rule), "*.") {
+		return isSubdomainOf(domain, base)
+	}
+	return domain == base || isSubdomainOf(domain, base)
+}
+
+// matchDomainRules 判断域名是否符合任意一条规则
+func matchDomainRules(rules []string, domain string) bool {
+	for _, rule := range rules {
+		if matchDomainRule(rule, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// domainRulesOverlap 判断两条规则是否可能匹配同一个域名
+func domainRulesOverlap(a, b string) bool {
+	baseA, patternA := domainRuleBase(a)
+	baseB, patternB := domainRuleBase(b)
+	if !patternA {
+		return matchDomainRule(b, baseA)
+	}
+	if !patternB {
+		return matchDomainRule(a, baseB)
+	}
+	return baseA == baseB || isSubdomainOf(baseA, baseB) || isSubdomainOf(baseB, baseA)
+}
+
+// findDomainConflict 查找与其他用户在同一服务器上重叠的域名规则, 未分配服务器的用户视为使用所有服务器
+func (c *HandleController) findDomainConflict(user string, allocations []ServerAllocation) (string, string, bool) {
+	type grant struct {
+		user   string
+		server string
+		rules  []string
+	}
+
+	var grants []grant
+	var userServers []model.UserServer
+	c.DB.Where("user <> ?", user).Find(&userServers)
+	for _, userServer := range userServers {
+		allocation, err := ToServerAllocation(userServer)
+		if err != nil {
+			continue
+		}
+		grants = append(grants, grant{user: userServer.User, server: allocation.Server, rules: allocation.Domains})
+	}
+	var userTokens []model.UserToken
+	c.DB.Where("user <> ? AND server = ''", user).Find(&userTokens)
+	for _, userToken := range userTokens {
+		info, err := ToUserTokenInfo(userToken)
+		if err != nil {
+			continue
+		}
+		grants = append(grants, grant{user: info.User, rules: info.Domains})
+	}
+
+	for _, allocation := range allocations {
+		for _, rule := range allocation.Domains {
+			if trimString(rule) == "" {
+				continue
+			}
+			for _, other := range grants {
+				if allocation.Server != "" && other.server != "" && allocation.Server != other.server {
+					continue
+				}
+				for _, otherRule := range other.rules {
+					if trimString(otherRule) != "" && domainRulesOverlap(rule, otherRule) {
+						return rule, other.user, true
+					}
+				}
+			}
+		}
+	}
+	return "", "", false
+}
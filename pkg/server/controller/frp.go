@@ -3,13 +3,19 @@ package controller
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"frps-panel/pkg/server/model"
 	"log"
 	"net/http"
+	"sync"
 
 	plugin "github.com/fatedier/frp/pkg/plugin/server"
 	"github.com/gin-gonic/gin"
 )
 
+// 旧的 /handler 路径只提示一次已弃用
+var legacyHandlerWarning sync.Once
+
 // frps连接处理
 func (c *HandleController) MakeHandlerFunc() gin.HandlerFunc {
 	return func(context *gin.Context) {
@@ -28,26 +34,48 @@ func (c *HandleController) MakeHandlerFunc() gin.HandlerFunc {
 			return
 		}
 
-		if request.Op == "Login" {
+		entry := model.PluginLog{Op: request.Op}
+		server, found := c.resolvePluginServer(context)
+		if !found {
+			response.Reject = true
+			response.RejectReason = fmt.Sprintf("unknown plugin path [%s], register the plugin at %s/<plugin key>", context.Request.URL.Path, HandlerUrl)
+			log.Printf("handle:%v , result: %v", request.Op, response.RejectReason)
+			entry.ClientAddr = context.ClientIP()
+			entry.Reject = true
+			entry.Reason = response.RejectReason
+			c.pluginLogger.Record(entry)
+			context.JSON(http.StatusOK, response)
+			return
+		}
+		entry.Server = server.Name
+
+		if request.Op == plugin.OpLogin {
 			content := plugin.LoginContent{}
 			err = json.Unmarshal(jsonStr, &content)
-			response = c.HandleLogin(&content, context.ClientIP())
-		} else if request.Op == "NewProxy" {
+			response = c.HandleLogin(&content, server)
+			entry.User, entry.RunID, entry.ClientAddr = content.User, content.RunID, content.ClientAddress
+		} else if request.Op == plugin.OpNewProxy {
 			content := plugin.NewProxyContent{}
 			err = json.Unmarshal(jsonStr, &content)
-			response = c.HandleNewProxy(&content)
-		} else if request.Op == "Ping" {
+			response = c.HandleNewProxy(&content, server)
+			entry.User, entry.RunID = content.User.User, content.User.RunID
+			entry.ProxyName, entry.ProxyType = content.ProxyName, content.ProxyType
+		} else if request.Op == plugin.OpPing {
 			content := plugin.PingContent{}
 			err = json.Unmarshal(jsonStr, &content)
-			response = c.HandlePing(&content)
-		} else if request.Op == "NewWorkConn" {
+			response = c.HandlePing(&content, server)
+			entry.User, entry.RunID = content.User.User, content.User.RunID
+		} else if request.Op == plugin.OpNewWorkConn {
 			content := plugin.NewWorkConnContent{}
 			err = json.Unmarshal(jsonStr, &content)
-			response = c.HandleNewWorkConn(&content)
-		} else if request.Op == "NewUserConn" {
+			response = c.HandleNewWorkConn(&content, server)
+			entry.User, entry.RunID = content.User.User, content.User.RunID
+		} else if request.Op == plugin.OpNewUserConn {
 			content := plugin.NewUserConnContent{}
 			err = json.Unmarshal(jsonStr, &content)
-			response = c.HandleNewUserConn(&content)
+			response = c.HandleNewUserConn(&content, server)
+			entry.User, entry.RunID, entry.ClientAddr = content.User.User, content.User.RunID, content.RemoteAddr
+			entry.ProxyName, entry.ProxyType = content.ProxyName, content.ProxyType
 		}
 
 		if err != nil {
@@ -61,10 +89,48 @@ func (c *HandleController) MakeHandlerFunc() gin.HandlerFunc {
 			}
 			return
 		} else {
-			resStr, _ := json.Marshal(response)
-			log.Printf("handle:%v , result: %v", request.Op, string(resStr))
+			// Content 中带有用户 token, 不能写入日志
+			log.Printf("handle:%v , reject: %v, unchange: %v, reason: %s", request.Op, response.Reject, response.Unchange, response.RejectReason)
+			entry.Reject = response.Reject
+			entry.Reason = response.RejectReason
+			c.pluginLogger.Record(entry)
 		}
 
 		context.JSON(http.StatusOK, response)
 	}
 }
+
+// resolvePluginServer 识别调用插件的 frps 服务器, 无法识别时返回 found=false, 请求被拒绝.
+// 通过 /handler/<plugin_key> 注册的插件按密钥识别; 旧的 /handler 路径只在开启 plugin_ip_fallback 时按来源 IP 与 dashboard 地址匹配
+func (c *HandleController) resolvePluginServer(context *gin.Context) (*ServerInfo, bool) {
+	key := trimString(context.Param("key"))
+	if key == "" {
+		if !c.CommonInfo.PluginIPFallback {
+			return nil, false
+		}
+		legacyHandlerWarning.Do(func() {
+			log.Printf("deprecated: frps calls the plugin at %s and is matched by IP, register the plugin at %s/<plugin key> instead", HandlerUrl, HandlerUrl)
+		})
+		// 密钥为十六进制, 加上前缀与密钥区分
+		return c.lookupPluginServer("ip/"+context.ClientIP(), "dashboard_addr = ?", context.ClientIP())
+	}
+	return c.lookupPluginServer(key, "plugin_key = ?", key)
+}
+
+// lookupPluginServer 按条件查询服务器, 查询结果 (包括没有匹配) 按 cacheKey 缓存
+func (c *HandleController) lookupPluginServer(cacheKey string, query string, arg string) (*ServerInfo, bool) {
+	if server, ok := c.pluginServers.Get(cacheKey); ok {
+		return server, server != nil
+	}
+	var servers []ServerInfo
+	if result := c.DB.Where(query, arg).Limit(1).Find(&servers); result.Error != nil {
+		log.Printf("failed to query plugin server: %v", result.Error)
+		return nil, false
+	}
+	if len(servers) == 0 {
+		c.pluginServers.Set(cacheKey, nil)
+		return nil, false
+	}
+	c.pluginServers.Set(cacheKey, &servers[0])
+	return &servers[0], true
+}
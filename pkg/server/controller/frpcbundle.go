@@ -0,0 +1,187 @@
+package controller
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 压缩包中除 frpc.toml 外的文件, 使用与配置模板相同的数据渲染
+var frpcBundleFiles = []struct {
+	name    string
+	content string
+	// windows 脚本使用 CRLF 换行
+	crlf bool
+}{
+	{name: "frpc.service", content: frpcSystemdUnit},
+	{name: "install-service.ps1", content: frpcWindowsScript, crlf: true},
+	{name: "README.txt", content: frpcBundleReadme},
+}
+
+const frpcSystemdUnit = `[Unit]
+Description = frp client for {{ .User }}@{{ .Server }}
+After = network-online.target
+Wants = network-online.target
+
+[Service]
+Type = simple
+# frpc 和 frpc.toml 的路径, 请按实际位置修改
+ExecStart = /usr/local/bin/frpc -c /etc/frp/frpc.toml
+Restart = on-failure
+RestartSec = 5s
+
+[Install]
+WantedBy = multi-user.target
+`
+
+const frpcWindowsScript = `# Registers frpc as a startup task running as SYSTEM (frpc is not a native Windows service).
+# Run from an elevated PowerShell in the folder containing frpc.exe and frpc.toml:
+#   powershell -ExecutionPolicy Bypass -File .\install-service.ps1
+# Remove it again with -Uninstall.
+param([switch]$Uninstall)
+
+$TaskName = "frpc-{{ .User }}"
+if ($Uninstall) {
+    Stop-ScheduledTask -TaskName $TaskName -ErrorAction SilentlyContinue
+    Unregister-ScheduledTask -TaskName $TaskName -Confirm:$false
+    exit
+}
+
+$Dir = Split-Path -Parent $MyInvocation.MyCommand.Path
+$Frpc = Join-Path $Dir "frpc.exe"
+if (-not (Test-Path $Frpc)) {
+    Write-Error "frpc.exe not found in $Dir"
+    exit 1
+}
+$Action = New-ScheduledTaskAction -Execute $Frpc -Argument ('-c "' + (Join-Path $Dir "frpc.toml") + '"') -WorkingDirectory $Dir
+$Trigger = New-ScheduledTaskTrigger -AtStartup
+$Principal = New-ScheduledTaskPrincipal -UserId "SYSTEM" -LogonType ServiceAccount -RunLevel Highest
+$Settings = New-ScheduledTaskSettingsSet -RestartCount 999 -RestartInterval (New-TimeSpan -Minutes 1) -ExecutionTimeLimit ([TimeSpan]::Zero)
+Register-ScheduledTask -TaskName $TaskName -Action $Action -Trigger $Trigger -Principal $Principal -Settings $Settings -Force | Out-Null
+Start-ScheduledTask -TaskName $TaskName
+Write-Host "frpc started as scheduled task $TaskName"
+`
+
+const frpcBundleReadme = `frpc bundle for {{ .User }}
+==========================
+
+Server:   {{ .Server }}
+Address:  {{ .ServerAddr }}:{{ .ServerPort }}
+User:     {{ .User }}
+Ports:    {{ if .Ports }}{{ join .Ports ", " }}{{ else }}-{{ end }}
+Domains:  {{ if .Domains }}{{ join .Domains ", " }}{{ else }}-{{ end }}
+Subdomains: {{ if .Subdomains }}{{ join .Subdomains ", " }}{{ if .SubdomainHost }} (under {{ .SubdomainHost }}){{ end }}{{ else }}-{{ end }}
+
+Files
+  frpc.toml            frpc config, keep it private: it contains your token
+  frpc.service         systemd unit for Linux
+  install-service.ps1  starts frpc at boot on Windows
+
+Linux
+  1. Download frpc from https://github.com/fatedier/frp/releases (v0.52.3 or later)
+  2. cp frpc /usr/local/bin/ && mkdir -p /etc/frp && cp frpc.toml /etc/frp/
+  3. cp frpc.service /etc/systemd/system/ && systemctl daemon-reload && systemctl enable --now frpc
+
+Windows
+  1. Put frpc.exe next to frpc.toml and install-service.ps1
+  2. In an elevated PowerShell: powershell -ExecutionPolicy Bypass -File .\install-service.ps1
+
+Remote ports and domains only work if they are listed above.
+
+----
+
+服务器：   {{ .Server }}
+地址：     {{ .ServerAddr }}:{{ .ServerPort }}
+用户：     {{ .User }}
+端口：     {{ if .Ports }}{{ join .Ports ", " }}{{ else }}-{{ end }}
+域名：     {{ if .Domains }}{{ join .Domains ", " }}{{ else }}-{{ end }}
+子域名：   {{ if .Subdomains }}{{ join .Subdomains ", " }}{{ if .SubdomainHost }}（{{ .SubdomainHost }} 下）{{ end }}{{ else }}-{{ end }}
+
+文件
+  frpc.toml            frpc 配置, 其中包含 token, 请勿泄露
+  frpc.service         Linux 的 systemd 服务
+  install-service.ps1  Windows 开机启动脚本
+
+Linux
+  1. 从 https://github.com/fatedier/frp/releases 下载 frpc (v0.52.3 及以上版本)
+  2. cp frpc /usr/local/bin/ && mkdir -p /etc/frp && cp frpc.toml /etc/frp/
+  3. cp frpc.service /etc/systemd/system/ && systemctl daemon-reload && systemctl enable --now frpc
+
+Windows
+  1. 将 frpc.exe 与 frpc.toml、install-service.ps1 放在同一目录
+  2. 在管理员 PowerShell 中执行: powershell -ExecutionPolicy Bypass -File .\install-service.ps1
+
+只能使用上面列出的远程端口和域名。
+`
+
+// BuildFrpcBundle 生成包含 frpc.toml、systemd 服务、windows 脚本和说明的压缩包
+func BuildFrpcBundle(config []byte, data FrpcConfigData) ([]byte, error) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	dir := fmt.Sprintf("frpc_%s/", data.User)
+	now := time.Now()
+
+	write := func(name string, content []byte) error {
+		w, err := archive.CreateHeader(&zip.FileHeader{Name: dir + name, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(content)
+		return err
+	}
+
+	if err := write("frpc.toml", config); err != nil {
+		return nil, err
+	}
+	for _, file := range frpcBundleFiles {
+		tmpl, err := template.New(file.name).Funcs(frpcTemplateFuncs).Parse(file.content)
+		if err != nil {
+			return nil, err
+		}
+		var content bytes.Buffer
+		if err := tmpl.Execute(&content, data); err != nil {
+			return nil, err
+		}
+		text := content.String()
+		if file.crlf {
+			text = strings.ReplaceAll(text, "\n", "\r\n")
+		}
+		if err := write(file.name, []byte(text)); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// 下载用户在服务器上的 frpc 压缩包, 普通用户只能下载自己的
+func (c *HandleController) MakeFrpcBundleFunc() func(context *gin.Context) {
+	return func(context *gin.Context) {
+		text, data, ok := c.frpcConfigRequest(context)
+		if !ok {
+			return
+		}
+		config, ok := renderValidFrpcConfig(context, text, data, FrpcFormatToml)
+		if !ok {
+			return
+		}
+		bundle, err := BuildFrpcBundle(config, data)
+		if err != nil {
+			context.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "Failed to build bundle: " + err.Error(),
+			})
+			return
+		}
+		context.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="frpc_%s_%s.zip"`, data.User, data.Server))
+		context.Data(http.StatusOK, "application/zip", bundle)
+	}
+}
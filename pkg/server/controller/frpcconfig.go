@@ -0,0 +1,477 @@
+package controller
+
+import (
+	"bytes"
+	gocontext "context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/BurntSushi/toml"
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// frpc 配置的输出格式, 模板总是渲染为 toml, 其他格式由 toml 转换
+const (
+	FrpcFormatToml = "toml"
+	FrpcFormatYaml = "yaml"
+	FrpcFormatJson = "json"
+	FrpcFormatIni  = "ini"
+)
+
+const (
+	// 无法从 frps 查询 bindPort 时使用的默认端口
+	defaultFrpsBindPort = 7000
+	proxyNameLength     = 8
+)
+
+var frpcFormatContentTypes = map[string]string{
+	FrpcFormatToml: "application/toml; charset=utf-8",
+	FrpcFormatYaml: "application/yaml; charset=utf-8",
+	FrpcFormatJson: "application/json; charset=utf-8",
+	FrpcFormatIni:  "text/plain; charset=utf-8",
+}
+
+// FrpcConfigData 是渲染 frpc 配置模板时可用的数据
+type FrpcConfigData struct {
+	Server        string
+	ServerAddr    string
+	ServerPort    int
+	User          string
+	Token         string
+	Ports         []string // 分配的端口, 端口范围形如 10000-10200
+	Port          int      // 第一个端口, 端口范围取起始端口
+	Domains       []string
+	Subdomains    []string // 分配的和用户申请的子域名
+	SubdomainHost string
+	ProxyName     string // 随机生成的 8 位代理名称
+}
+
+// 旧模板在浏览器中替换的占位符, 渲染前转换为模板语法
+var legacyPlaceholder = regexp.MustCompile(`("?)\{(ServerIP|ServerPort|User|token|Port|ProxyName)\}("?)`)
+
+var legacyPlaceholderFields = map[string]string{
+	"ServerIP":   "ServerAddr",
+	"ServerPort": "ServerPort",
+	"User":       "User",
+	"token":      "Token",
+	"Port":       "Port",
+	"ProxyName":  "ProxyName",
+}
+
+// convertLegacyTemplate 转换旧模板的占位符, 没有引号的字符串字段加上引号
+func convertLegacyTemplate(text string) string {
+	return legacyPlaceholder.ReplaceAllStringFunc(text, func(match string) string {
+		parts := legacyPlaceholder.FindStringSubmatch(match)
+		field := legacyPlaceholderFields[parts[2]]
+		if parts[1] == `"` && parts[3] == `"` {
+			return `"{{ .` + field + ` }}"`
+		}
+		if field == "ServerPort" || field == "Port" {
+			return parts[1] + "{{ ." + field + " }}" + parts[3]
+		}
+		return parts[1] + "{{ quote ." + field + " }}" + parts[3]
+	})
+}
+
+var frpcTemplateFuncs = template.FuncMap{
+	"quote": quoteTomlString,
+	"join":  strings.Join,
+	"portRange": func(port string) ([]int, error) {
+		start, end, err := parsePortRange(port)
+		if err != nil {
+			return nil, err
+		}
+		ports := make([]int, 0, end-start+1)
+		for p := start; p <= end; p++ {
+			ports = append(ports, p)
+		}
+		return ports, nil
+	},
+}
+
+// quoteTomlString 返回 toml 基本字符串, json 的转义在 toml 中同样有效
+func quoteTomlString(s string) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+func parsePortRange(port string) (int, int, error) {
+	port = strings.TrimSpace(port)
+	startStr, endStr, isRange := strings.Cut(port, "-")
+	start, err := strconv.Atoi(strings.TrimSpace(startStr))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port [%s]", port)
+	}
+	if !isRange {
+		return start, start, nil
+	}
+	end, err := strconv.Atoi(strings.TrimSpace(endStr))
+	if err != nil || end < start {
+		return 0, 0, fmt.Errorf("invalid port range [%s]", port)
+	}
+	return start, end, nil
+}
+
+func randomProxyName() string {
+	name, err := randomString(proxyNameLength)
+	if err != nil {
+		// 名称只用于区分代理, 取不到随机数时使用固定名称
+		return "frpc"
+	}
+	return name
+}
+
+// loadConfigTemplate 读取内置的默认模板, 数据库中没有保存过模板时使用
+func (c *HandleController) loadConfigTemplate() (string, error) {
+	data, err := os.ReadFile(filepath.Join(c.assetsDir, "static", "config_template.json"))
+	if err != nil {
+		return "", err
+	}
+	var configTemplate struct {
+		Template string `json:"template"`
+	}
+	if err := json.Unmarshal(data, &configTemplate); err != nil {
+		return "", err
+	}
+	return configTemplate.Template, nil
+}
+
+// RenderFrpcConfig 渲染模板并转换为指定格式
+func RenderFrpcConfig(text string, data FrpcConfigData, format string) ([]byte, error) {
+	tmpl, err := template.New("frpc").Funcs(frpcTemplateFuncs).Option("missingkey=error").Parse(convertLegacyTemplate(text))
+	if err != nil {
+		return nil, fmt.Errorf("invalid config template: %w", err)
+	}
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return nil, fmt.Errorf("failed to render config template: %w", err)
+	}
+	if format == FrpcFormatToml {
+		return rendered.Bytes(), nil
+	}
+
+	conf := make(map[string]any)
+	if _, err := toml.Decode(rendered.String(), &conf); err != nil {
+		return nil, fmt.Errorf("rendered config is not valid toml: %w", err)
+	}
+	switch format {
+	case FrpcFormatJson:
+		return json.MarshalIndent(conf, "", "  ")
+	case FrpcFormatYaml:
+		return yaml.Marshal(conf)
+	case FrpcFormatIni:
+		return toLegacyIni(conf)
+	}
+	return nil, fmt.Errorf("unsupported format [%s]", format)
+}
+
+// 新旧配置中名称不能按驼峰转下划线得到的配置项
+var legacyCommonKeys = map[string]string{
+	"auth.method":        "authentication_method",
+	"auth.token":         "token",
+	"log.to":             "log_file",
+	"webServer.addr":     "admin_addr",
+	"webServer.port":     "admin_port",
+	"webServer.user":     "admin_user",
+	"webServer.password": "admin_pwd",
+}
+
+var legacyProxyKeys = map[string]string{
+	"plugin.type":             "plugin",
+	"secretKey":               "sk",
+	"httpPassword":            "http_pwd",
+	"loadBalancer.group":      "group",
+	"loadBalancer.groupKey":   "group_key",
+	"requestHeaders.set.Host": "host_header_rewrite",
+}
+
+// 旧配置中去掉前缀的配置项
+var legacyDroppedPrefixes = []string{"transport."}
+
+// toLegacyIni 将 v0.52 的配置转换为旧版 ini 格式
+func toLegacyIni(conf map[string]any) ([]byte, error) {
+	var buf bytes.Buffer
+	common := make(map[string]any)
+	flattenConfig("", conf, common, "proxies", "visitors")
+	writeIniSection(&buf, "common", common, legacyCommonKeys)
+
+	for _, section := range []string{"proxies", "visitors"} {
+		tables, _ := conf[section].([]map[string]any)
+		for _, table := range tables {
+			name, _ := table["name"].(string)
+			if name == "" {
+				return nil, fmt.Errorf("every entry of [%s] needs a name", section)
+			}
+			values := make(map[string]any)
+			flattenConfig("", table, values, "name")
+			if section == "visitors" {
+				values["role"] = "visitor"
+			}
+			buf.WriteString("\n")
+			writeIniSection(&buf, name, values, legacyProxyKeys)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func flattenConfig(prefix string, value map[string]any, out map[string]any, skip ...string) {
+	for key, v := range value {
+		if prefix == "" && containsString(skip, key) {
+			continue
+		}
+		if table, ok := v.(map[string]any); ok {
+			flattenConfig(prefix+key+".", table, out)
+			continue
+		}
+		out[prefix+key] = v
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func writeIniSection(buf *bytes.Buffer, name string, values map[string]any, renames map[string]string) {
+	lines := make([]string, 0, len(values))
+	for key, value := range values {
+		lines = append(lines, legacyIniKey(key, renames)+" = "+legacyIniValue(value))
+	}
+	sort.Strings(lines)
+	buf.WriteString("[" + name + "]\n")
+	for _, line := range lines {
+		buf.WriteString(line + "\n")
+	}
+}
+
+// legacyIniKey 转换配置项名称, metadatas.x 转为 meta_x, 其他按驼峰转下划线并用下划线连接
+func legacyIniKey(key string, renames map[string]string) string {
+	if legacy, ok := renames[key]; ok {
+		return legacy
+	}
+	if meta, ok := strings.CutPrefix(key, "metadatas."); ok {
+		return "meta_" + meta
+	}
+	if header, ok := strings.CutPrefix(key, "requestHeaders.set."); ok {
+		return "header_" + header
+	}
+	for _, prefix := range legacyDroppedPrefixes {
+		key = strings.TrimPrefix(key, prefix)
+	}
+	parts := strings.Split(key, ".")
+	for i, part := range parts {
+		parts[i] = snakeCase(part)
+	}
+	return strings.Join(parts, "_")
+}
+
+func legacyIniValue(value any) string {
+	switch v := value.(type) {
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, legacyIniValue(item))
+		}
+		return strings.Join(items, ",")
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// snakeCase 将驼峰名称转为下划线, 连续的大写字母视为一个单词, 如 localIP 转为 local_ip
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prevLower := unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || (unicode.IsUpper(runes[i-1]) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// frpcConfigData 汇总用户在服务器上的端口、域名和子域名, 以及服务器的连接地址
+func (c *HandleController) frpcConfigData(context *gin.Context, info UserTokenInfo, allocation ServerAllocation, server ServerInfo) FrpcConfigData {
+	data := FrpcConfigData{
+		Server:     server.Name,
+		ServerAddr: frpcServerAddr(context, server.DashboardAddr),
+		ServerPort: defaultFrpsBindPort,
+		User:       info.User,
+		Token:      info.Token,
+		Domains:    allocation.Domains,
+		ProxyName:  randomProxyName(),
+	}
+	for _, port := range allocation.Ports {
+		data.Ports = append(data.Ports, strings.TrimSpace(fmt.Sprintf("%v", port)))
+	}
+	if len(data.Ports) > 0 {
+		data.Port, _, _ = parsePortRange(data.Ports[0])
+	}
+	data.Subdomains = append(data.Subdomains, allocation.Subdomains...)
+	for _, subdomain := range c.claimedSubdomains(info.User, server.Name) {
+		if !containsString(data.Subdomains, subdomain) {
+			data.Subdomains = append(data.Subdomains, subdomain)
+		}
+	}
+
+	if client, err := c.frpsClients.Get(server); err == nil {
+		ctx, cancel := gocontext.WithTimeout(context.Request.Context(), frpsActionTimeout)
+		defer cancel()
+		if serverInfo, err := client.ServerInfo(ctx); err == nil {
+			if serverInfo.BindPort > 0 {
+				data.ServerPort = serverInfo.BindPort
+			}
+			data.SubdomainHost = serverInfo.SubdomainHost
+		}
+	}
+	return data
+}
+
+// frpcServerAddr 返回 frpc 连接的地址, dashboard 只监听本机时使用访问面板的域名
+func frpcServerAddr(context *gin.Context, dashboardAddr string) string {
+	addr := strings.TrimSpace(dashboardAddr)
+	addr = strings.TrimPrefix(addr, "http://")
+	addr = strings.TrimPrefix(addr, "https://")
+	addr = strings.TrimSuffix(addr, "/")
+	if ip := net.ParseIP(addr); addr == "" || addr == "localhost" || (ip != nil && (ip.IsLoopback() || ip.IsUnspecified())) {
+		host, _, err := net.SplitHostPort(context.Request.Host)
+		if err != nil {
+			host = context.Request.Host
+		}
+		return host
+	}
+	return addr
+}
+
+// defaultServerOf 返回用户默认的服务器, 没有分配服务器时使用当前服务器
+func (c *HandleController) defaultServerOf(info UserTokenInfo) string {
+	if info.Server != "" {
+		return info.Server
+	}
+	if len(info.Servers) > 0 {
+		return info.Servers[0].Server
+	}
+	var servers []ServerInfo
+	if result := c.DB.Find(&servers); result.Error == nil && c.CurrentDashboardIndex < len(servers) {
+		return servers[c.CurrentDashboardIndex].Name
+	}
+	return ""
+}
+
+// frpcConfigRequest 解析请求中的用户和服务器, 返回服务器使用的模板和渲染数据, 失败时已写入错误响应
+func (c *HandleController) frpcConfigRequest(context *gin.Context) (string, FrpcConfigData, bool) {
+	user := requestUser(context)
+	if user == "" {
+		context.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "user is required",
+		})
+		return "", FrpcConfigData{}, false
+	}
+
+	info, err := c.queryUserTokenInfo(user)
+	if err != nil {
+		context.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("user [%s] not found", user),
+		})
+		return "", FrpcConfigData{}, false
+	}
+	serverName := trimString(context.Query("server"))
+	if serverName == "" {
+		serverName = c.defaultServerOf(info)
+	}
+	allocation, ok := info.allocationFor(serverName)
+	if !ok {
+		context.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("user [%s] is not allowed on server [%s]", user, serverName),
+		})
+		return "", FrpcConfigData{}, false
+	}
+	var server ServerInfo
+	if result := c.DB.Where("name = ?", serverName).Limit(1).Find(&server); result.Error != nil || result.RowsAffected == 0 {
+		context.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("server [%s] not found", serverName),
+		})
+		return "", FrpcConfigData{}, false
+	}
+
+	text, err := c.configTemplateFor(serverName)
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to load config template: " + err.Error(),
+		})
+		return "", FrpcConfigData{}, false
+	}
+	return text, c.frpcConfigData(context, info, allocation, server), true
+}
+
+// renderValidFrpcConfig 渲染配置并通过 frp 校验, 失败时已写入错误响应
+func renderValidFrpcConfig(context *gin.Context, text string, data FrpcConfigData, format string) ([]byte, bool) {
+	content, err := RenderFrpcConfig(text, data, format)
+	if err == nil {
+		err = ValidateFrpcConfig(content, format)
+	}
+	if err != nil {
+		context.JSON(http.StatusUnprocessableEntity, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return nil, false
+	}
+	return content, true
+}
+
+// 生成用户在服务器上的 frpc 配置, 普通用户只能生成自己的配置
+func (c *HandleController) MakeFrpcConfigFunc() func(context *gin.Context) {
+	return func(context *gin.Context) {
+		format := strings.ToLower(trimString(context.DefaultQuery("format", FrpcFormatToml)))
+		contentType, ok := frpcFormatContentTypes[format]
+		if !ok {
+			context.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "format must be one of toml, yaml, json, ini",
+			})
+			return
+		}
+		text, data, ok := c.frpcConfigRequest(context)
+		if !ok {
+			return
+		}
+		content, ok := renderValidFrpcConfig(context, text, data, format)
+		if !ok {
+			return
+		}
+
+		if context.Query("download") != "" {
+			context.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="frpc_%s.%s"`, data.User, format))
+		}
+		context.Data(http.StatusOK, contentType, content)
+	}
+}
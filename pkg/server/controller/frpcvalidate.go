@@ -0,0 +1,227 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fatedier/frp/pkg/config"
+	"github.com/fatedier/frp/pkg/config/legacy"
+	v1 "github.com/fatedier/frp/pkg/config/v1"
+	"github.com/fatedier/frp/pkg/config/v1/validation"
+	toml "github.com/pelletier/go-toml/v2"
+)
+
+// FrpcConfigError 是生成的 frpc 配置没有通过 frp 校验的原因, Line 为生成的配置中的行号, 0 表示无法定位
+type FrpcConfigError struct {
+	Format string
+	Line   int
+	Err    error
+}
+
+func (e *FrpcConfigError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s line %d: %v", e.Format, e.Line, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.Format, e.Err)
+}
+
+func (e *FrpcConfigError) Unwrap() error {
+	return e.Err
+}
+
+// ValidateFrpcConfig 使用 frp 的配置加载和校验检查生成的 frpc 配置
+func ValidateFrpcConfig(content []byte, format string) error {
+	var (
+		common   *v1.ClientCommonConfig
+		proxies  []v1.ProxyConfigurer
+		visitors []v1.VisitorConfigurer
+	)
+	if format == FrpcFormatIni {
+		legacyCommon, err := legacy.UnmarshalClientConfFromIni(content)
+		if err == nil {
+			err = legacyCommon.Validate()
+		}
+		if err != nil {
+			return &FrpcConfigError{Format: format, Err: err}
+		}
+		legacyProxies, legacyVisitors, err := legacy.LoadAllProxyConfsFromIni("", content, nil)
+		if err != nil {
+			return &FrpcConfigError{Format: format, Err: err}
+		}
+		common = legacy.Convert_ClientCommonConf_To_v1(&legacyCommon)
+		for _, name := range sortedKeys(legacyProxies) {
+			proxies = append(proxies, legacy.Convert_ProxyConf_To_v1(legacyProxies[name]))
+		}
+		for _, name := range sortedKeys(legacyVisitors) {
+			visitors = append(visitors, legacy.Convert_VisitorConf_To_v1(legacyVisitors[name]))
+		}
+	} else {
+		// frp 解析 toml 失败时会按 yaml 解析, 先单独检查 toml 语法以便给出行号
+		if format == FrpcFormatToml {
+			var v any
+			if err := toml.Unmarshal(content, &v); err != nil {
+				var decodeErr *toml.DecodeError
+				if errors.As(err, &decodeErr) {
+					line, _ := decodeErr.Position()
+					return &FrpcConfigError{Format: format, Line: line, Err: err}
+				}
+				return &FrpcConfigError{Format: format, Err: err}
+			}
+		}
+		var all v1.ClientConfig
+		if err := config.LoadConfigure(content, &all); err != nil {
+			return &FrpcConfigError{Format: format, Err: err}
+		}
+		common = &all.ClientCommonConfig
+		for _, proxy := range all.Proxies {
+			proxies = append(proxies, proxy.ProxyConfigurer)
+		}
+		for _, visitor := range all.Visitors {
+			visitors = append(visitors, visitor.VisitorConfigurer)
+		}
+	}
+
+	// include 的是客户端本地的文件, 面板上无法检查
+	common.IncludeConfigFiles = nil
+	common.Complete()
+	if _, err := validation.ValidateClientCommonConfig(common); err != nil {
+		return &FrpcConfigError{Format: format, Err: err}
+	}
+
+	names := make(map[string]bool)
+	for _, proxy := range proxies {
+		if proxy == nil {
+			return &FrpcConfigError{Format: format, Err: errors.New("proxy type is missing or not supported")}
+		}
+		base := proxy.GetBaseConfig()
+		name := base.Name
+		// Complete 会给名称加上用户前缀, 需要先检查名称
+		if name == "" {
+			return &FrpcConfigError{Format: format, Err: errors.New("proxy name should not be empty")}
+		}
+		line := frpcNameLine(content, format, name)
+		if names[name] {
+			return &FrpcConfigError{Format: format, Line: line, Err: fmt.Errorf("proxy %s: duplicate proxy name", name)}
+		}
+		names[name] = true
+		proxy.Complete(common.User)
+		if err := validation.ValidateProxyConfigurerForClient(proxy); err != nil {
+			if strings.HasPrefix(err.Error(), "localPort") {
+				line = frpcKeyLine(content, format, line, "localPort")
+			}
+			return &FrpcConfigError{Format: format, Line: line, Err: fmt.Errorf("proxy %s: %v", name, err)}
+		}
+		if base.Plugin.Type == "" && !validLocalIP(base.LocalIP) {
+			return &FrpcConfigError{Format: format, Line: frpcKeyLine(content, format, line, "localIP"), Err: fmt.Errorf("proxy %s: localIP [%s] is not a valid address", name, base.LocalIP)}
+		}
+	}
+	for _, visitor := range visitors {
+		if visitor == nil {
+			return &FrpcConfigError{Format: format, Err: errors.New("visitor type is missing or not supported")}
+		}
+		name := visitor.GetBaseConfig().Name
+		visitor.Complete(common)
+		if err := validation.ValidateVisitorConfigurer(visitor); err != nil {
+			return &FrpcConfigError{Format: format, Line: frpcNameLine(content, format, name), Err: fmt.Errorf("visitor %s: %v", name, err)}
+		}
+	}
+	return nil
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// validLocalIP 只由数字和点组成的地址必须是合法的 IP, 如 127.0.1 无法连接
+func validLocalIP(host string) bool {
+	if host == "" || net.ParseIP(host) != nil {
+		return true
+	}
+	return strings.Trim(host, "0123456789.") != ""
+}
+
+// frpcNameLine 返回代理或访问者名称在生成的配置中所在的行
+func frpcNameLine(content []byte, format string, name string) int {
+	for i, line := range strings.Split(string(content), "\n") {
+		compact := strings.ReplaceAll(strings.TrimSpace(line), " ", "")
+		var match bool
+		switch format {
+		case FrpcFormatIni:
+			match = compact == "["+name+"]"
+		case FrpcFormatYaml:
+			compact = strings.TrimPrefix(compact, "-")
+			match = compact == "name:"+name || compact == "name:"+strconv.Quote(name)
+		case FrpcFormatJson:
+			match = strings.HasPrefix(compact, `"name":`+strconv.Quote(name))
+		default:
+			match = strings.HasPrefix(compact, "name="+strconv.Quote(name)) || strings.HasPrefix(compact, "name='"+name+"'")
+		}
+		if match {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// frpcKeyLine 在 toml 中查找名称所在的 [[proxies]] 中配置项所在的行, 找不到或其他格式时返回名称所在的行
+func frpcKeyLine(content []byte, format string, nameLine int, key string) int {
+	if format != FrpcFormatToml || nameLine == 0 {
+		return nameLine
+	}
+	lines := strings.Split(string(content), "\n")
+	start := nameLine - 1
+	for start > 0 && !strings.HasPrefix(strings.TrimSpace(lines[start]), "[") {
+		start--
+	}
+	for i := start + 1; i < len(lines); i++ {
+		compact := strings.ReplaceAll(strings.TrimSpace(lines[i]), " ", "")
+		if strings.HasPrefix(compact, "[") {
+			break
+		}
+		if strings.HasPrefix(compact, key+"=") {
+			return i + 1
+		}
+	}
+	return nameLine
+}
+
+// text/template 的错误形如 template: frpc:3:8: ..., 其中 3 为模板中的行号
+var templateErrorLine = regexp.MustCompile(`template: frpc:(\d+)`)
+
+// templateLineOf 返回错误对应的模板行号, 模板错误直接取行号,
+// 生成的 toml 中出错的行在模板中只出现一次时返回该行, 否则返回 0
+func templateLineOf(text string, rendered []byte, err error) int {
+	if m := templateErrorLine.FindStringSubmatch(err.Error()); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		return line
+	}
+	var configErr *FrpcConfigError
+	if !errors.As(err, &configErr) || configErr.Format != FrpcFormatToml || configErr.Line == 0 {
+		return 0
+	}
+	renderedLines := strings.Split(string(rendered), "\n")
+	if configErr.Line > len(renderedLines) {
+		return 0
+	}
+	target := strings.TrimSpace(renderedLines[configErr.Line-1])
+	line := 0
+	for i, templateLine := range strings.Split(text, "\n") {
+		if strings.TrimSpace(templateLine) == target {
+			if line != 0 {
+				return 0
+			}
+			line = i + 1
+		}
+	}
+	return line
+}
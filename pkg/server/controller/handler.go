@@ -2,73 +2,129 @@ package controller
 
 import (
 	"fmt"
-	"frps-panel/pkg/server/model"
 	"log"
 	"strconv"
 	"strings"
+	"time"
 
 	plugin "github.com/fatedier/frp/pkg/plugin/server"
 )
 
-func (c *HandleController) HandleLogin(content *plugin.LoginContent, remoteIP string) plugin.Response {
+func (c *HandleController) HandleLogin(content *plugin.LoginContent, server *ServerInfo) plugin.Response {
 	token := content.Metas["token"]
 	user := content.User
-	res := c.JudgeToken(user, token)
+	// frpc 重连时沿用原来的 run id, 被踢下线的会话不能重新登录
+	if c.sessions.isKicked(content.RunID) {
+		return plugin.Response{
+			Reject:       true,
+			RejectReason: fmt.Sprintf("session of user [%s] was closed by admin", user),
+		}
+	}
+	res := c.JudgeToken(user, token, plugin.OpLogin)
 	if res.Reject {
 		return res
 	}
-
-	var userToken model.UserToken
-	if result := c.DB.Where("user = ?", user).First(&userToken); result.Error == nil {
-		if userToken.Server != "" {
-			var serverConf model.ServerInfo
-			if result := c.DB.Where("name = ?", userToken.Server).First(&serverConf); result.Error != nil {
-				res.Reject = true
-				res.RejectReason = fmt.Sprintf("user [%s] is configured for server [%s], but this server is not defined", user, userToken.Server)
-				return res
-			}
-
-			if serverConf.Name == "" {
-				res.Reject = true
-				res.RejectReason = fmt.Sprintf("user [%s] is configured for server [%s], but this server is not defined", user, userToken.Server)
-			} else if serverConf.DashboardAddr != remoteIP {
-				res.Reject = true
-				res.RejectReason = fmt.Sprintf("user [%s] is not allowed to login from this server [%s]", user, remoteIP)
-			}
+	res = c.JudgeServer(user, server)
+	if !res.Reject {
+		serverName := ""
+		if server != nil {
+			serverName = server.Name
 		}
+		c.sessions.login(serverName, user, content.RunID)
 	}
 	return res
 }
 
-func (c *HandleController) HandleNewProxy(content *plugin.NewProxyContent) plugin.Response {
+func (c *HandleController) HandleNewProxy(content *plugin.NewProxyContent, server *ServerInfo) plugin.Response {
 	token := content.User.Metas["token"]
 	user := content.User.User
-	judgeToken := c.JudgeToken(user, token)
+	if res := c.JudgeSession(user, content.User.RunID, server); res.Reject {
+		return res
+	}
+	judgeToken := c.JudgeToken(user, token, plugin.OpNewProxy)
 	if judgeToken.Reject {
 		return judgeToken
 	}
-	return c.JudgePort(content)
+	judgeServer := c.JudgeServer(user, server)
+	if judgeServer.Reject {
+		return judgeServer
+	}
+
+	// 先按用户策略和带宽档位改写代理内容, 再对改写后的内容做端口和域名校验
+	changed := false
+	if info, err := c.queryUserTokenInfo(user); err == nil {
+		serverName := ""
+		if server != nil {
+			serverName = server.Name
+		}
+		plan, limited := info.bandwidthPlan()
+		if limited {
+			if err := checkBandwidthPlan(content, plan); err != nil {
+				return plugin.Response{
+					Reject:       true,
+					RejectReason: fmt.Sprintf("user [%s] %v", user, err),
+				}
+			}
+		}
+		allocation, _ := info.allocationFor(serverName)
+		changed = info.Policy.Apply(content, allocation)
+		if limited && applyBandwidthPlan(content, plan) {
+			changed = true
+		}
+	}
+
+	if res := JudgeProxyName(content); res.Reject {
+		return res
+	}
+
+	res := c.JudgePort(content, server)
+	if !res.Reject && changed {
+		res.Unchange = false
+		res.Content = content
+	}
+	return res
 }
 
-func (c *HandleController) HandlePing(content *plugin.PingContent) plugin.Response {
+func (c *HandleController) HandlePing(content *plugin.PingContent, server *ServerInfo) plugin.Response {
 	token := content.User.Metas["token"]
 	user := content.User.User
-	return c.JudgeToken(user, token)
+	if res := c.JudgeSession(user, content.User.RunID, server); res.Reject {
+		return res
+	}
+	res := c.JudgeToken(user, token, plugin.OpPing)
+	if res.Reject {
+		return res
+	}
+	return c.JudgeServer(user, server)
 }
 
-func (c *HandleController) HandleNewWorkConn(content *plugin.NewWorkConnContent) plugin.Response {
+func (c *HandleController) HandleNewWorkConn(content *plugin.NewWorkConnContent, server *ServerInfo) plugin.Response {
 	token := content.User.Metas["token"]
 	user := content.User.User
-	return c.JudgeToken(user, token)
+	if res := c.JudgeSession(user, content.User.RunID, server); res.Reject {
+		return res
+	}
+	res := c.JudgeToken(user, token, plugin.OpNewWorkConn)
+	if res.Reject {
+		return res
+	}
+	return c.JudgeServer(user, server)
 }
 
-func (c *HandleController) HandleNewUserConn(content *plugin.NewUserConnContent) plugin.Response {
+func (c *HandleController) HandleNewUserConn(content *plugin.NewUserConnContent, server *ServerInfo) plugin.Response {
 	token := content.User.Metas["token"]
 	user := content.User.User
-	return c.JudgeToken(user, token)
+	if res := c.JudgeSession(user, content.User.RunID, server); res.Reject {
+		return res
+	}
+	res := c.JudgeToken(user, token, plugin.OpNewUserConn)
+	if res.Reject {
+		return res
+	}
+	return c.JudgeServer(user, server)
 }
 
-func (c *HandleController) JudgeToken(user string, token string) plugin.Response {
+func (c *HandleController) JudgeToken(user string, token string, op string) plugin.Response {
 	var res plugin.Response
 	if user == "" || token == "" {
 		res.Reject = true
@@ -76,27 +132,86 @@ func (c *HandleController) JudgeToken(user string, token string) plugin.Response
 		return res
 	}
 
-	var userToken model.UserToken
-	if result := c.DB.Where("user = ?", user).First(&userToken); result.Error != nil {
+	info, err := c.queryUserTokenInfo(user)
+	if err != nil {
 		res.Reject = true
 		res.RejectReason = fmt.Sprintf("user [%s] not exist", user)
 		return res
 	}
 
-	if !userToken.Enable {
+	if !info.Enable {
 		res.Reject = true
 		res.RejectReason = fmt.Sprintf("user [%s] is disabled", user)
-	} else if userToken.Token != token {
+	} else if info.Token != token && !info.previousTokenValid(token, time.Now()) {
 		res.Reject = true
 		res.RejectReason = fmt.Sprintf("invalid meta token for user [%s]", user)
 	} else {
 		res.Unchange = true
 	}
 
+	// 超出流量配额后拒绝新建代理和工作连接, 直到进入新周期或管理员充值
+	if !res.Reject && (op == plugin.OpNewProxy || op == plugin.OpNewWorkConn) {
+		if exceeded, reason := info.quotaExceeded(); exceeded {
+			res.Reject = true
+			res.Unchange = false
+			res.RejectReason = reason
+		}
+	}
+
+	// 访问时间表只限制登录、新建代理和新用户连接, 已建立的会话保持心跳
+	if !res.Reject && (op == plugin.OpLogin || op == plugin.OpNewProxy || op == plugin.OpNewUserConn) {
+		if allowed, reason := JudgeSchedule(user, info.Schedule, time.Now()); !allowed {
+			res.Reject = true
+			res.Unchange = false
+			res.RejectReason = reason
+		}
+	}
+
+	return res
+}
+
+// JudgeServer 判断用户是否允许使用发起请求的 frps 服务器
+func (c *HandleController) JudgeServer(user string, server *ServerInfo) plugin.Response {
+	var res plugin.Response
+
+	info, err := c.queryUserTokenInfo(user)
+	if err != nil {
+		res.Reject = true
+		res.RejectReason = fmt.Sprintf("user [%s] not exist", user)
+		return res
+	}
+
+	if len(info.Servers) == 0 {
+		res.Unchange = true
+		return res
+	}
+
+	if server == nil {
+		res.Reject = true
+		res.RejectReason = fmt.Sprintf("user [%s] is configured for server [%s], but the calling server can not be identified", user, strings.Join(info.serverNames(), ","))
+	} else if _, ok := info.allocationFor(server.Name); !ok {
+		res.Reject = true
+		res.RejectReason = fmt.Sprintf("user [%s] is not allowed to use server [%s]", user, server.Name)
+	} else {
+		res.Unchange = true
+	}
+	return res
+}
+
+// JudgeProxyName 要求代理名称以 "<用户名>." 开头, 与 frpc 设置 user 后生成的名称一致
+func JudgeProxyName(content *plugin.NewProxyContent) plugin.Response {
+	var res plugin.Response
+	user := content.User.User
+	if name, ok := strings.CutPrefix(content.ProxyName, user+"."); !ok || name == "" {
+		res.Reject = true
+		res.RejectReason = fmt.Sprintf("proxy name [%s] must be named [%s.<name>], set user = \"%s\" in frpc or enable the proxy name prefix policy", content.ProxyName, user, user)
+		return res
+	}
+	res.Unchange = true
 	return res
 }
 
-func (c *HandleController) JudgePort(content *plugin.NewProxyContent) plugin.Response {
+func (c *HandleController) JudgePort(content *plugin.NewProxyContent, server *ServerInfo) plugin.Response {
 	var res plugin.Response
 	var portErr error
 	var reject = false
@@ -115,62 +230,68 @@ func (c *HandleController) JudgePort(content *plugin.NewProxyContent) plugin.Res
 	userDomains := content.CustomDomains
 	userSubdomain := content.SubDomain
 
+	info, err := c.queryUserTokenInfo(user)
+	if err != nil {
+		res.Reject = true
+		res.RejectReason = fmt.Sprintf("failed to query user [%v]: %v", user, err)
+		return res
+	}
+	serverName := ""
+	if server != nil {
+		serverName = server.Name
+	}
+	allocation, ok := info.allocationFor(serverName)
+	if !ok {
+		res.Reject = true
+		res.RejectReason = fmt.Sprintf("user [%s] is not allowed to use server [%s]", user, serverName)
+		return res
+	}
+
 	portAllowed := true
 	if proxyType == "tcp" || proxyType == "udp" {
 		portAllowed = false
-		var userToken model.UserToken
-		if result := c.DB.Where("user = ?", user).First(&userToken); result.Error == nil {
-			info, err := ToUserTokenInfo(userToken)
-			if err != nil {
-				portErr = fmt.Errorf("failed to convert user token: %v", err)
-			} else {
-				for _, port := range info.Ports {
-					if str, ok := port.(string); ok {
-						if strings.Contains(str, "-") {
-							allowedRanges := strings.Split(str, "-")
-							if len(allowedRanges) != 2 {
-								portErr = fmt.Errorf("user [%v] port range [%v] format error", user, port)
-								break
-							}
-							start, err := strconv.Atoi(trimString(allowedRanges[0]))
-							if err != nil {
-								portErr = fmt.Errorf("user [%v] port rang [%v] start port [%v] is not a number", user, port, allowedRanges[0])
-								break
-							}
-							end, err := strconv.Atoi(trimString(allowedRanges[1]))
-							if err != nil {
-								portErr = fmt.Errorf("user [%v] port rang [%v] end port [%v] is not a number", user, port, allowedRanges[0])
-								break
-							}
-							if max(userPort, start) == userPort && min(userPort, end) == userPort {
-								portAllowed = true
-								break
-							}
-						} else {
-							if str == "" {
-								portAllowed = true
-								break
-							}
-							allowed, err := strconv.Atoi(str)
-							if err != nil {
-								portErr = fmt.Errorf("user [%v] allowed port [%v] is not a number", user, port)
-							}
-							if allowed == userPort {
-								portAllowed = true
-								break
-							}
-						}
-					} else {
-						allowed := port
-						if allowed == userPort {
-							portAllowed = true
-							break
-						}
+		for _, port := range allocation.Ports {
+			if str, ok := port.(string); ok {
+				if strings.Contains(str, "-") {
+					allowedRanges := strings.Split(str, "-")
+					if len(allowedRanges) != 2 {
+						portErr = fmt.Errorf("user [%v] port range [%v] format error", user, port)
+						break
+					}
+					start, err := strconv.Atoi(trimString(allowedRanges[0]))
+					if err != nil {
+						portErr = fmt.Errorf("user [%v] port rang [%v] start port [%v] is not a number", user, port, allowedRanges[0])
+						break
+					}
+					end, err := strconv.Atoi(trimString(allowedRanges[1]))
+					if err != nil {
+						portErr = fmt.Errorf("user [%v] port rang [%v] end port [%v] is not a number", user, port, allowedRanges[0])
+						break
+					}
+					if max(userPort, start) == userPort && min(userPort, end) == userPort {
+						portAllowed = true
+						break
+					}
+				} else {
+					if str == "" {
+						portAllowed = true
+						break
+					}
+					allowed, err := strconv.Atoi(str)
+					if err != nil {
+						portErr = fmt.Errorf("user [%v] allowed port [%v] is not a number", user, port)
+					}
+					if allowed == userPort {
+						portAllowed = true
+						break
 					}
 				}
+			} else if allowed, ok := port.(float64); ok {
+				if int(allowed) == userPort {
+					portAllowed = true
+					break
+				}
 			}
-		} else {
-			portAllowed = true
 		}
 	}
 	if !portAllowed {
@@ -183,21 +304,11 @@ func (c *HandleController) JudgePort(content *plugin.NewProxyContent) plugin.Res
 	domainAllowed := true
 	if proxyType == "http" || proxyType == "https" || proxyType == "tcpmux" {
 		if portAllowed {
-			var userToken model.UserToken
-			if result := c.DB.Where("user = ?", user).First(&userToken); result.Error == nil {
-				info, err := ToUserTokenInfo(userToken)
-				if err != nil {
-					portErr = fmt.Errorf("failed to convert user token: %v", err)
-				} else {
-					if stringContains("", info.Domains) {
-						domainAllowed = true
-					} else {
-						for _, userDomain := range userDomains {
-							if !stringContains(userDomain, info.Domains) {
-								domainAllowed = false
-								break
-							}
-						}
+			if !stringContains("", allocation.Domains) {
+				for _, userDomain := range userDomains {
+					if !matchDomainRules(allocation.Domains, userDomain) {
+						domainAllowed = false
+						break
 					}
 				}
 			}
@@ -212,29 +323,30 @@ func (c *HandleController) JudgePort(content *plugin.NewProxyContent) plugin.Res
 	if proxyType == "http" || proxyType == "https" {
 		subdomainAllowed = false
 		if portAllowed && domainAllowed {
-			var userToken model.UserToken
-			if result := c.DB.Where("user = ?", user).First(&userToken); result.Error == nil {
-				info, err := ToUserTokenInfo(userToken)
-				if err != nil {
-					portErr = fmt.Errorf("failed to convert user token: %v", err)
-				} else {
-					if stringContains("", info.Subdomains) {
+			// 缓存中的分配会被多个请求共享, 不能在其切片上追加
+			allowedSubdomains := append(append([]string{}, allocation.Subdomains...), c.claimedSubdomains(user, serverName)...)
+			if stringContains("", allowedSubdomains) {
+				subdomainAllowed = true
+			} else {
+				for _, subdomain := range allowedSubdomains {
+					if strings.EqualFold(subdomain, userSubdomain) {
 						subdomainAllowed = true
-					} else {
-						for _, subdomain := range info.Subdomains {
-							if subdomain == userSubdomain {
-								subdomainAllowed = true
-								break
-							}
-						}
+						break
 					}
 				}
-			} else {
-				subdomainAllowed = true
 			}
 			if !subdomainAllowed {
 				portErr = fmt.Errorf("user [%v] subdomain [%v] is not allowed", user, userSubdomain)
 				reject = true
+			} else if userSubdomain != "" {
+				// 不限子域名的用户也不能使用保留子域名或其他用户拥有的子域名
+				if c.isReservedSubdomain(userSubdomain) {
+					portErr = fmt.Errorf("user [%v] subdomain [%v] is reserved", user, userSubdomain)
+					reject = true
+				} else if owner, taken := c.findSubdomainOwner(user, serverName, userSubdomain); taken {
+					portErr = fmt.Errorf("user [%v] subdomain [%v] is owned by user [%v]", user, userSubdomain, owner)
+					reject = true
+				}
 			}
 		}
 	}
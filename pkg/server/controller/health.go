@@ -0,0 +1,303 @@
+package controller
+
+import (
+	gocontext "context"
+	"fmt"
+	"frps-panel/pkg/server/model"
+	"html"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultHealthCheckInterval = 30 * time.Second
+	healthCheckTimeout         = 5 * time.Second
+	healthProbeRetentionDays   = 30
+)
+
+type ServerStatus struct {
+	Name      string `json:"name"`
+	Up        bool   `json:"up"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+	Since     string `json:"since"`
+	CheckedAt string `json:"checked_at"`
+	Uptime24h string `json:"uptime_24h"`
+	Uptime7d  string `json:"uptime_7d"`
+	Uptime30d string `json:"uptime_30d"`
+}
+
+// healthChecker 定时探测各 frps 的 dashboard, 记录每次探测结果和上下线变化
+type healthChecker struct {
+	db       *gorm.DB
+	clients  *serverClients
+	interval time.Duration
+
+	mu     sync.RWMutex
+	status map[string]ServerStatus
+}
+
+// newHealthChecker 根据配置的秒数启动探测, 0 使用默认值, 负数表示不探测
+func newHealthChecker(db *gorm.DB, clients *serverClients, intervalSeconds int) *healthChecker {
+	if db == nil || intervalSeconds < 0 {
+		return nil
+	}
+	h := &healthChecker{
+		db:       db,
+		clients:  clients,
+		interval: defaultHealthCheckInterval,
+		status:   make(map[string]ServerStatus),
+	}
+	if intervalSeconds > 0 {
+		h.interval = time.Duration(intervalSeconds) * time.Second
+	}
+	go h.run()
+	return h
+}
+
+func (h *healthChecker) run() {
+	lastPrune := time.Time{}
+	for {
+		h.probeAll()
+		if time.Since(lastPrune) > 24*time.Hour {
+			h.prune()
+			lastPrune = time.Now()
+		}
+		time.Sleep(h.interval)
+	}
+}
+
+func (h *healthChecker) probeAll() {
+	var servers []ServerInfo
+	if result := h.db.Find(&servers); result.Error != nil {
+		log.Printf("failed to query servers for health check: %v", result.Error)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, server := range servers {
+		wg.Add(1)
+		go func(server ServerInfo) {
+			defer wg.Done()
+			h.probe(server)
+		}(server)
+	}
+	wg.Wait()
+}
+
+// probe 探测一台服务器, 状态与上次不同时记录一次上下线事件
+func (h *healthChecker) probe(server ServerInfo) {
+	ctx, cancel := gocontext.WithTimeout(gocontext.Background(), healthCheckTimeout)
+	defer cancel()
+	start := time.Now()
+	client, err := h.clients.Get(server)
+	if err == nil {
+		_, err = client.ServerInfo(ctx)
+	}
+	probe := model.ServerProbe{
+		Server:    server.Name,
+		Up:        err == nil,
+		LatencyMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		probe.Error = err.Error()
+	}
+	if result := h.db.Create(&probe); result.Error != nil {
+		log.Printf("failed to save health check of server [%s]: %v", server.Name, result.Error)
+	}
+
+	now := time.Now().Format("2006-01-02 15:04:05")
+	// 读写数据库时不持有锁, 避免数据库较慢时阻塞状态查询; 同一台服务器的探测不会并发执行
+	h.mu.RLock()
+	previous, known := h.status[server.Name]
+	h.mu.RUnlock()
+	if !known {
+		// 面板重启后以最近一次事件作为状态起点
+		var event model.ServerStatusEvent
+		if result := h.db.Where("server = ?", server.Name).Order("id desc").Limit(1).Find(&event); result.Error == nil && result.RowsAffected > 0 {
+			previous = ServerStatus{Up: event.Up, Since: event.CreatedAt.Format("2006-01-02 15:04:05")}
+			known = true
+		}
+	}
+	status := ServerStatus{
+		Name:      server.Name,
+		Up:        probe.Up,
+		LatencyMs: probe.LatencyMs,
+		Error:     probe.Error,
+		Since:     previous.Since,
+		CheckedAt: now,
+	}
+	changed := !known || previous.Up != probe.Up
+	if changed {
+		status.Since = now
+	}
+	h.mu.Lock()
+	h.status[server.Name] = status
+	h.mu.Unlock()
+
+	if changed {
+		if probe.Up {
+			log.Printf("server [%s] is up", server.Name)
+		} else {
+			log.Printf("server [%s] is down: %s", server.Name, probe.Error)
+		}
+		event := model.ServerStatusEvent{Server: server.Name, Up: probe.Up, Error: probe.Error}
+		if result := h.db.Create(&event); result.Error != nil {
+			log.Printf("failed to save status event of server [%s]: %v", server.Name, result.Error)
+		}
+	}
+}
+
+func (h *healthChecker) prune() {
+	before := time.Now().AddDate(0, 0, -healthProbeRetentionDays)
+	if result := h.db.Unscoped().Where("created_at < ?", before).Delete(&model.ServerProbe{}); result.Error != nil {
+		log.Printf("failed to prune health checks: %v", result.Error)
+	}
+}
+
+// Status 返回服务器最近一次的探测状态
+func (h *healthChecker) Status(name string) (ServerStatus, bool) {
+	if h == nil {
+		return ServerStatus{}, false
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	status, ok := h.status[name]
+	return status, ok
+}
+
+// uptime 返回服务器在 since 之后探测成功的比例, 没有探测记录时返回空
+func (h *healthChecker) uptime(name string, since time.Time) string {
+	var stats struct {
+		Total int64
+		Up    int64
+	}
+	result := h.db.Model(&model.ServerProbe{}).
+		Select("COUNT(*) AS total, COALESCE(SUM(CASE WHEN up THEN 1 ELSE 0 END), 0) AS up").
+		Where("server = ? AND created_at >= ?", name, since).
+		Scan(&stats)
+	if result.Error != nil || stats.Total == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%.2f%%", float64(stats.Up)*100/float64(stats.Total))
+}
+
+// 查询所有服务器的当前状态和可用率
+func (c *HandleController) MakeServerStatusFunc() func(context *gin.Context) {
+	return func(context *gin.Context) {
+		if c.healthChecker == nil {
+			context.JSON(http.StatusOK, gin.H{"success": false, "message": "health check is disabled"})
+			return
+		}
+
+		var servers []ServerInfo
+		if result := c.DB.Find(&servers); result.Error != nil {
+			context.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Failed to query servers"})
+			return
+		}
+
+		now := time.Now()
+		statuses := make([]ServerStatus, 0, len(servers))
+		for _, server := range servers {
+			status, ok := c.healthChecker.Status(server.Name)
+			if !ok {
+				status = ServerStatus{Name: server.Name, Error: "not checked yet"}
+			}
+			status.Uptime24h = c.healthChecker.uptime(server.Name, now.Add(-24*time.Hour))
+			status.Uptime7d = c.healthChecker.uptime(server.Name, now.AddDate(0, 0, -7))
+			status.Uptime30d = c.healthChecker.uptime(server.Name, now.AddDate(0, 0, -30))
+			statuses = append(statuses, status)
+		}
+
+		context.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "query server status success",
+			"data":    statuses,
+		})
+	}
+}
+
+// 查询服务器的上下线记录和每天的可用率
+func (c *HandleController) MakeServerStatusHistoryFunc() func(context *gin.Context) {
+	return func(context *gin.Context) {
+		server := trimString(context.Query("server"))
+		days, _ := strconv.Atoi(context.DefaultQuery("days", "7"))
+		if days < 1 || days > healthProbeRetentionDays {
+			days = 7
+		}
+		since := time.Now().AddDate(0, 0, -days)
+
+		var events []model.ServerStatusEvent
+		if result := c.DB.Where("server = ? AND created_at >= ?", server, since).Order("id desc").Find(&events); result.Error != nil {
+			context.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Failed to query status events"})
+			return
+		}
+		transitions := make([]gin.H, 0, len(events))
+		for _, event := range events {
+			transitions = append(transitions, gin.H{
+				"time":  event.CreatedAt.Format("2006-01-02 15:04:05"),
+				"up":    event.Up,
+				"error": event.Error,
+			})
+		}
+
+		var daily []struct {
+			Day       string  `json:"day"`
+			Total     int64   `json:"total"`
+			Up        int64   `json:"up"`
+			LatencyMs float64 `json:"latency_ms"`
+		}
+		result := c.DB.Model(&model.ServerProbe{}).
+			Select("DATE_FORMAT(created_at, '%Y-%m-%d') AS day, COUNT(*) AS total, "+
+				"COALESCE(SUM(CASE WHEN up THEN 1 ELSE 0 END), 0) AS up, COALESCE(AVG(CASE WHEN up THEN latency_ms END), 0) AS latency_ms").
+			Where("server = ? AND created_at >= ?", server, since).
+			Group("day").Order("day").
+			Scan(&daily)
+		if result.Error != nil {
+			context.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Failed to query health checks"})
+			return
+		}
+
+		context.JSON(http.StatusOK, gin.H{
+			"success":     true,
+			"message":     "query server status history success",
+			"transitions": transitions,
+			"daily":       daily,
+		})
+	}
+}
+
+// 以 SVG 徽章显示服务器状态
+func (c *HandleController) MakeServerBadgeFunc() func(context *gin.Context) {
+	return func(context *gin.Context) {
+		name := context.Param("name")
+		label, color := "unknown", "#9f9f9f"
+		if status, ok := c.healthChecker.Status(name); ok {
+			if status.Up {
+				label, color = "up", "#4c1"
+			} else {
+				label, color = "down", "#e05d44"
+			}
+		}
+
+		text := name
+		nameWidth, labelWidth := 10+7*len([]rune(text)), 10+7*len(label)
+		width := nameWidth + labelWidth
+		svg := fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="20" role="img" aria-label="%s: %s">`+
+			`<rect width="%d" height="20" fill="#555"/><rect x="%d" width="%d" height="20" fill="%s"/>`+
+			`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,sans-serif" font-size="11">`+
+			`<text x="%d" y="14">%s</text><text x="%d" y="14">%s</text></g></svg>`,
+			width, html.EscapeString(text), label,
+			nameWidth, nameWidth, labelWidth, color,
+			nameWidth/2, html.EscapeString(text), nameWidth+labelWidth/2, label)
+
+		context.Header("Cache-Control", "no-cache")
+		context.Data(http.StatusOK, "image/svg+xml; charset=utf-8", []byte(svg))
+	}
+}
@@ -11,70 +11,150 @@ import (
 func (c *HandleController) MakeLangFunc() func(context *gin.Context) {
 	return func(context *gin.Context) {
 		context.JSON(http.StatusOK, gin.H{
-			"User":                  ginI18n.MustGetMessage(context, "User"),
-			"Token":                 ginI18n.MustGetMessage(context, "Token"),
-			"Server":                ginI18n.MustGetMessage(context, "Server"),
-			"CreateDate":            ginI18n.MustGetMessage(context, "Create Date"),
-			"ExpireDate":            ginI18n.MustGetMessage(context, "Expire Date"),
-			"Notes":                 ginI18n.MustGetMessage(context, "Notes"),
-			"Status":                ginI18n.MustGetMessage(context, "Status"),
-			"Operation":             ginI18n.MustGetMessage(context, "Operation"),
-			"Enable":                ginI18n.MustGetMessage(context, "Enable"),
-			"Disable":               ginI18n.MustGetMessage(context, "Disable"),
-			"NewUser":               ginI18n.MustGetMessage(context, "New user"),
-			"Confirm":               ginI18n.MustGetMessage(context, "Confirm"),
-			"Cancel":                ginI18n.MustGetMessage(context, "Cancel"),
-			"RemoveUser":            ginI18n.MustGetMessage(context, "Remove user"),
-			"DisableUser":           ginI18n.MustGetMessage(context, "Disable user"),
-			"ConfirmRemoveUser":     ginI18n.MustGetMessage(context, "Confirm to remove user"),
-			"ConfirmDisableUser":    ginI18n.MustGetMessage(context, "Confirm to disable user"),
-			"TakeTimeMakeEffective": ginI18n.MustGetMessage(context, "will take sometime to make effective"),
-			"ConfirmEnableUser":     ginI18n.MustGetMessage(context, "Confirm to enable user"),
-			"OperateSuccess":        ginI18n.MustGetMessage(context, "Operate success"),
-			"OperateError":          ginI18n.MustGetMessage(context, "Operate error"),
-			"OperateFailed":         ginI18n.MustGetMessage(context, "Operate failed"),
-			"UserExist":             ginI18n.MustGetMessage(context, "User exist"),
-			"UserNotExist":          ginI18n.MustGetMessage(context, "User not exist"),
-			"UserFormatError":       ginI18n.MustGetMessage(context, "User format error"),
-			"TokenFormatError":      ginI18n.MustGetMessage(context, "Token format error"),
-			"ShouldCheckUser":       ginI18n.MustGetMessage(context, "Please check at least one user"),
-			"OperationConfirm":      ginI18n.MustGetMessage(context, "Operation confirm"),
-			"EmptyData":             ginI18n.MustGetMessage(context, "Empty data"),
-			"NotLimit":              ginI18n.MustGetMessage(context, "Not limit"),
-			"AllowedPorts":          ginI18n.MustGetMessage(context, "Allowed ports"),
-			"AllowedDomains":        ginI18n.MustGetMessage(context, "Allowed domains"),
-			"AllowedSubdomains":     ginI18n.MustGetMessage(context, "Allowed subdomains"),
-			"PortsInvalid":          ginI18n.MustGetMessage(context, "Ports is invalid"),
-			"DomainsInvalid":        ginI18n.MustGetMessage(context, "Domains is invalid"),
-			"SubdomainsInvalid":     ginI18n.MustGetMessage(context, "Subdomains is invalid"),
-			"CommentInvalid":        ginI18n.MustGetMessage(context, "Comment is invalid"),
-			"ParamError":            ginI18n.MustGetMessage(context, "Param error"),
-			"OtherError":            ginI18n.MustGetMessage(context, "Other error"),
-			"Name":                  ginI18n.MustGetMessage(context, "Name"),
-			"Port":                  ginI18n.MustGetMessage(context, "Port"),
-			"Connections":           ginI18n.MustGetMessage(context, "Connections"),
-			"TrafficIn":             ginI18n.MustGetMessage(context, "Traffic In"),
-			"TrafficOut":            ginI18n.MustGetMessage(context, "Traffic Out"),
-			"ClientVersion":         ginI18n.MustGetMessage(context, "Client Version"),
-			"TrafficStatistics":     ginI18n.MustGetMessage(context, "Traffic Statistics"),
-			"online":                ginI18n.MustGetMessage(context, "online"),
-			"offline":               ginI18n.MustGetMessage(context, "offline"),
-			"true":                  ginI18n.MustGetMessage(context, "true"),
-			"false":                 ginI18n.MustGetMessage(context, "false"),
-			"NetworkTraffic":        ginI18n.MustGetMessage(context, "Network Traffic"),
-			"today":                 ginI18n.MustGetMessage(context, "today"),
-			"now":                   ginI18n.MustGetMessage(context, "now"),
-			"Proxies":               ginI18n.MustGetMessage(context, "Proxies"),
-			"NotSet":                ginI18n.MustGetMessage(context, "Not Set"),
-			"Proxy":                 ginI18n.MustGetMessage(context, "Proxy"),
-			"TokenInvalid":          ginI18n.MustGetMessage(context, "Token invalid"),
-			"Total":                 ginI18n.MustGetMessage(context, "Total"),
-			"Items":                 ginI18n.MustGetMessage(context, "Items"),
-			"Goto":                  ginI18n.MustGetMessage(context, "Go to"),
-			"PerPage":               ginI18n.MustGetMessage(context, "Per Page"),
-			"ConfigTemplate":        ginI18n.MustGetMessage(context, "ConfigTemplate"),       // 新增
-			"PortCount":             ginI18n.MustGetMessage(context, "PortCount"),            // 新增
-			"PleaseInputPortCount":  ginI18n.MustGetMessage(context, "PleaseInputPortCount"), // 新增
+			"User":                   ginI18n.MustGetMessage(context, "User"),
+			"Token":                  ginI18n.MustGetMessage(context, "Token"),
+			"Server":                 ginI18n.MustGetMessage(context, "Server"),
+			"CreateDate":             ginI18n.MustGetMessage(context, "Create Date"),
+			"ExpireDate":             ginI18n.MustGetMessage(context, "Expire Date"),
+			"Notes":                  ginI18n.MustGetMessage(context, "Notes"),
+			"Status":                 ginI18n.MustGetMessage(context, "Status"),
+			"Operation":              ginI18n.MustGetMessage(context, "Operation"),
+			"Enable":                 ginI18n.MustGetMessage(context, "Enable"),
+			"Disable":                ginI18n.MustGetMessage(context, "Disable"),
+			"NewUser":                ginI18n.MustGetMessage(context, "New user"),
+			"Confirm":                ginI18n.MustGetMessage(context, "Confirm"),
+			"Cancel":                 ginI18n.MustGetMessage(context, "Cancel"),
+			"RemoveUser":             ginI18n.MustGetMessage(context, "Remove user"),
+			"DisableUser":            ginI18n.MustGetMessage(context, "Disable user"),
+			"ConfirmRemoveUser":      ginI18n.MustGetMessage(context, "Confirm to remove user"),
+			"ConfirmDisableUser":     ginI18n.MustGetMessage(context, "Confirm to disable user"),
+			"TakeTimeMakeEffective":  ginI18n.MustGetMessage(context, "will take sometime to make effective"),
+			"ConfirmEnableUser":      ginI18n.MustGetMessage(context, "Confirm to enable user"),
+			"OperateSuccess":         ginI18n.MustGetMessage(context, "Operate success"),
+			"OperateError":           ginI18n.MustGetMessage(context, "Operate error"),
+			"OperateFailed":          ginI18n.MustGetMessage(context, "Operate failed"),
+			"UserExist":              ginI18n.MustGetMessage(context, "User exist"),
+			"UserNotExist":           ginI18n.MustGetMessage(context, "User not exist"),
+			"UserFormatError":        ginI18n.MustGetMessage(context, "User format error"),
+			"TokenFormatError":       ginI18n.MustGetMessage(context, "Token format error"),
+			"ShouldCheckUser":        ginI18n.MustGetMessage(context, "Please check at least one user"),
+			"OperationConfirm":       ginI18n.MustGetMessage(context, "Operation confirm"),
+			"EmptyData":              ginI18n.MustGetMessage(context, "Empty data"),
+			"NotLimit":               ginI18n.MustGetMessage(context, "Not limit"),
+			"AllowedPorts":           ginI18n.MustGetMessage(context, "Allowed ports"),
+			"AllowedDomains":         ginI18n.MustGetMessage(context, "Allowed domains"),
+			"AllowedSubdomains":      ginI18n.MustGetMessage(context, "Allowed subdomains"),
+			"PortsInvalid":           ginI18n.MustGetMessage(context, "Ports is invalid"),
+			"DomainsInvalid":         ginI18n.MustGetMessage(context, "Domains is invalid"),
+			"SubdomainsInvalid":      ginI18n.MustGetMessage(context, "Subdomains is invalid"),
+			"CommentInvalid":         ginI18n.MustGetMessage(context, "Comment is invalid"),
+			"ParamError":             ginI18n.MustGetMessage(context, "Param error"),
+			"OtherError":             ginI18n.MustGetMessage(context, "Other error"),
+			"Name":                   ginI18n.MustGetMessage(context, "Name"),
+			"Port":                   ginI18n.MustGetMessage(context, "Port"),
+			"Connections":            ginI18n.MustGetMessage(context, "Connections"),
+			"TrafficIn":              ginI18n.MustGetMessage(context, "Traffic In"),
+			"TrafficOut":             ginI18n.MustGetMessage(context, "Traffic Out"),
+			"ClientVersion":          ginI18n.MustGetMessage(context, "Client Version"),
+			"TrafficStatistics":      ginI18n.MustGetMessage(context, "Traffic Statistics"),
+			"online":                 ginI18n.MustGetMessage(context, "online"),
+			"offline":                ginI18n.MustGetMessage(context, "offline"),
+			"true":                   ginI18n.MustGetMessage(context, "true"),
+			"false":                  ginI18n.MustGetMessage(context, "false"),
+			"NetworkTraffic":         ginI18n.MustGetMessage(context, "Network Traffic"),
+			"today":                  ginI18n.MustGetMessage(context, "today"),
+			"now":                    ginI18n.MustGetMessage(context, "now"),
+			"Proxies":                ginI18n.MustGetMessage(context, "Proxies"),
+			"NotSet":                 ginI18n.MustGetMessage(context, "Not Set"),
+			"Proxy":                  ginI18n.MustGetMessage(context, "Proxy"),
+			"TokenInvalid":           ginI18n.MustGetMessage(context, "Token invalid"),
+			"Total":                  ginI18n.MustGetMessage(context, "Total"),
+			"Items":                  ginI18n.MustGetMessage(context, "Items"),
+			"Goto":                   ginI18n.MustGetMessage(context, "Go to"),
+			"PerPage":                ginI18n.MustGetMessage(context, "Per Page"),
+			"ConfigTemplate":         ginI18n.MustGetMessage(context, "ConfigTemplate"),       // 新增
+			"PortCount":              ginI18n.MustGetMessage(context, "PortCount"),            // 新增
+			"PleaseInputPortCount":   ginI18n.MustGetMessage(context, "PleaseInputPortCount"), // 新增
+			"ExpireDateInvalid":      ginI18n.MustGetMessage(context, "ExpireDateInvalid"),
+			"Schedule":               ginI18n.MustGetMessage(context, "Schedule"),
+			"ScheduleInvalid":        ginI18n.MustGetMessage(context, "ScheduleInvalid"),
+			"Sunday":                 ginI18n.MustGetMessage(context, "Sunday"),
+			"Monday":                 ginI18n.MustGetMessage(context, "Monday"),
+			"Tuesday":                ginI18n.MustGetMessage(context, "Tuesday"),
+			"Wednesday":              ginI18n.MustGetMessage(context, "Wednesday"),
+			"Thursday":               ginI18n.MustGetMessage(context, "Thursday"),
+			"Friday":                 ginI18n.MustGetMessage(context, "Friday"),
+			"Saturday":               ginI18n.MustGetMessage(context, "Saturday"),
+			"ConfirmRotatePluginKey": ginI18n.MustGetMessage(context, "Confirm to rotate plugin key"),
+			"Servers":                ginI18n.MustGetMessage(context, "Servers"),
+			"ServersInvalid":         ginI18n.MustGetMessage(context, "ServersInvalid"),
+			"DomainsConflict":        ginI18n.MustGetMessage(context, "DomainsConflict"),
+			"SubdomainsReserved":     ginI18n.MustGetMessage(context, "SubdomainsReserved"),
+			"SubdomainsConflict":     ginI18n.MustGetMessage(context, "SubdomainsConflict"),
+			"Policy":                 ginI18n.MustGetMessage(context, "Policy"),
+			"PolicyInvalid":          ginI18n.MustGetMessage(context, "PolicyInvalid"),
+			"BandwidthUpload":        ginI18n.MustGetMessage(context, "Bandwidth upload"),
+			"BandwidthDownload":      ginI18n.MustGetMessage(context, "Bandwidth download"),
+			"BandwidthInvalid":       ginI18n.MustGetMessage(context, "BandwidthInvalid"),
+			"Time":                   ginI18n.MustGetMessage(context, "Time"),
+			"Op":                     ginI18n.MustGetMessage(context, "Op"),
+			"Result":                 ginI18n.MustGetMessage(context, "Result"),
+			"Accepted":               ginI18n.MustGetMessage(context, "Accepted"),
+			"Rejected":               ginI18n.MustGetMessage(context, "Rejected"),
+			"Reason":                 ginI18n.MustGetMessage(context, "Reason"),
+			"ClientAddress":          ginI18n.MustGetMessage(context, "Client Address"),
+			"ProxyName":              ginI18n.MustGetMessage(context, "Proxy Name"),
+			"Actor":                  ginI18n.MustGetMessage(context, "Actor"),
+			"Action":                 ginI18n.MustGetMessage(context, "Action"),
+			"Target":                 ginI18n.MustGetMessage(context, "Target"),
+			"SourceIP":               ginI18n.MustGetMessage(context, "Source IP"),
+			"Payload":                ginI18n.MustGetMessage(context, "Payload"),
+			"Quota":                  ginI18n.MustGetMessage(context, "Quota"),
+			"QuotaUsed":              ginI18n.MustGetMessage(context, "Quota used"),
+			"QuotaInvalid":           ginI18n.MustGetMessage(context, "QuotaInvalid"),
+			"Unlimited":              ginI18n.MustGetMessage(context, "Unlimited"),
+			"Version":                ginI18n.MustGetMessage(context, "Version"),
+			"ClientCounts":           ginI18n.MustGetMessage(context, "Client Counts"),
+			"CurrentConnections":     ginI18n.MustGetMessage(context, "Current Connections"),
+			"ProxyCounts":            ginI18n.MustGetMessage(context, "Proxy Counts"),
+			"Reachable":              ginI18n.MustGetMessage(context, "Reachable"),
+			"Unreachable":            ginI18n.MustGetMessage(context, "Unreachable"),
+			"Latency":                ginI18n.MustGetMessage(context, "Latency"),
+			"All":                    ginI18n.MustGetMessage(context, "All"),
+			"Up":                     ginI18n.MustGetMessage(context, "Up"),
+			"Down":                   ginI18n.MustGetMessage(context, "Down"),
+			"Since":                  ginI18n.MustGetMessage(context, "Since"),
+			"CheckedAt":              ginI18n.MustGetMessage(context, "Checked at"),
+			"Uptime24h":              ginI18n.MustGetMessage(context, "Uptime 24h"),
+			"Uptime7d":               ginI18n.MustGetMessage(context, "Uptime 7d"),
+			"Uptime30d":              ginI18n.MustGetMessage(context, "Uptime 30d"),
+			"History":                ginI18n.MustGetMessage(context, "History"),
+			"Day":                    ginI18n.MustGetMessage(context, "Day"),
+			"Uptime":                 ginI18n.MustGetMessage(context, "Uptime"),
+			"Error":                  ginI18n.MustGetMessage(context, "Error"),
+			"TlsVerifyNone":          ginI18n.MustGetMessage(context, "TLS not enabled"),
+			"TlsVerifySystem":        ginI18n.MustGetMessage(context, "TLS verified by system CA"),
+			"TlsVerifyCa":            ginI18n.MustGetMessage(context, "TLS verified by custom CA"),
+			"TlsVerifyPinned":        ginI18n.MustGetMessage(context, "TLS certificate pinned"),
+			"TlsVerifyInsecure":      ginI18n.MustGetMessage(context, "TLS insecure"),
+			"EditDashboard":          ginI18n.MustGetMessage(context, "Edit dashboard"),
+			"SecretUnchanged":        ginI18n.MustGetMessage(context, "Set, leave empty to keep unchanged"),
+			"ConfirmKickUser":        ginI18n.MustGetMessage(context, "Confirm to kick user"),
+			"AllowReconnect":         ginI18n.MustGetMessage(context, "Allow reconnect"),
+			"ConfirmClearOffline":    ginI18n.MustGetMessage(context, "Confirm to clear offline proxies"),
+			"ExportConfig":           ginI18n.MustGetMessage(context, "ExportConfig"),
+			"ConfigFormat":           ginI18n.MustGetMessage(context, "Config Format"),
+			"Download":               ginI18n.MustGetMessage(context, "Download"),
+			"DownloadBundle":         ginI18n.MustGetMessage(context, "Download bundle"),
+			"Copy":                   ginI18n.MustGetMessage(context, "Copy"),
+			"CopiedToClipboard":      ginI18n.MustGetMessage(context, "Copied to clipboard"),
+			"DefaultTemplate":        ginI18n.MustGetMessage(context, "Default template"),
+			"InheritTemplate":        ginI18n.MustGetMessage(context, "Inherit default template"),
+			"TemplateComment":        ginI18n.MustGetMessage(context, "Template comment"),
+			"Diff":                   ginI18n.MustGetMessage(context, "Diff"),
+			"Rollback":               ginI18n.MustGetMessage(context, "Rollback"),
+			"ConfirmRollback":        ginI18n.MustGetMessage(context, "Confirm to rollback template"),
+			"SampleConfig":           ginI18n.MustGetMessage(context, "Sample config"),
 		})
 	}
 }
@@ -0,0 +1,184 @@
+package controller
+
+import (
+	gocontext "context"
+	"frps-panel/pkg/frpsclient"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 汇总查询时每台服务器的超时时间, 不可达的服务器不影响其他服务器的结果
+const overviewServerTimeout = 5 * time.Second
+
+type ServerOverview struct {
+	Name            string           `json:"name"`
+	Reachable       bool             `json:"reachable"`
+	Error           string           `json:"error,omitempty"`
+	LatencyMs       int64            `json:"latency_ms"`
+	Version         string           `json:"version"`
+	BindPort        int              `json:"bind_port"`
+	ClientCounts    int64            `json:"client_counts"`
+	CurConns        int64            `json:"cur_conns"`
+	ProxyCounts     int64            `json:"proxy_counts"`
+	ProxyTypeCounts map[string]int64 `json:"proxy_type_counts"`
+	TrafficIn       int64            `json:"traffic_in"`
+	TrafficOut      int64            `json:"traffic_out"`
+}
+
+// ServerProxy 是带有所在服务器名称的代理
+type ServerProxy struct {
+	Server string `json:"server"`
+	frpsclient.ProxyStats
+}
+
+type OverviewTotal struct {
+	Servers      int   `json:"servers"`
+	Reachable    int   `json:"reachable"`
+	ClientCounts int64 `json:"client_counts"`
+	CurConns     int64 `json:"cur_conns"`
+	ProxyCounts  int64 `json:"proxy_counts"`
+	TrafficIn    int64 `json:"traffic_in"`
+	TrafficOut   int64 `json:"traffic_out"`
+}
+
+// queryServerOverview 查询单台服务器的 serverinfo
+func (c *HandleController) queryServerOverview(server ServerInfo) ServerOverview {
+	overview := ServerOverview{Name: server.Name, ProxyTypeCounts: map[string]int64{}}
+	ctx, cancel := gocontext.WithTimeout(gocontext.Background(), overviewServerTimeout)
+	defer cancel()
+	start := time.Now()
+	client, err := c.frpsClients.Get(server)
+	var info *frpsclient.ServerInfo
+	if err == nil {
+		info, err = client.ServerInfo(ctx)
+	}
+	overview.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		overview.Error = err.Error()
+		return overview
+	}
+
+	overview.Reachable = true
+	overview.Version = info.Version
+	overview.BindPort = info.BindPort
+	overview.ClientCounts = info.ClientCounts
+	overview.CurConns = info.CurConns
+	overview.TrafficIn = info.TotalTrafficIn
+	overview.TrafficOut = info.TotalTrafficOut
+	overview.ProxyCounts = info.ProxyCounts()
+	if info.ProxyTypeCounts != nil {
+		overview.ProxyTypeCounts = info.ProxyTypeCounts
+	}
+	return overview
+}
+
+// 并发查询所有服务器, 汇总服务器信息、客户端数、代理数和流量
+func (c *HandleController) MakeOverviewFunc() func(context *gin.Context) {
+	return func(context *gin.Context) {
+		var servers []ServerInfo
+		if result := c.DB.Find(&servers); result.Error != nil {
+			context.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Failed to query servers"})
+			return
+		}
+
+		overviews := make([]ServerOverview, len(servers))
+		var wg sync.WaitGroup
+		for i, server := range servers {
+			wg.Add(1)
+			go func(i int, server ServerInfo) {
+				defer wg.Done()
+				overviews[i] = c.queryServerOverview(server)
+			}(i, server)
+		}
+		wg.Wait()
+
+		total := OverviewTotal{Servers: len(overviews)}
+		for _, overview := range overviews {
+			if !overview.Reachable {
+				continue
+			}
+			total.Reachable++
+			total.ClientCounts += overview.ClientCounts
+			total.CurConns += overview.CurConns
+			total.ProxyCounts += overview.ProxyCounts
+			total.TrafficIn += overview.TrafficIn
+			total.TrafficOut += overview.TrafficOut
+		}
+
+		context.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "query overview success",
+			"total":   total,
+			"servers": overviews,
+		})
+	}
+}
+
+// 并发查询所有服务器中指定类型的代理, 每个代理附带所在服务器名称
+func (c *HandleController) MakeOverviewProxiesFunc() func(context *gin.Context) {
+	return func(context *gin.Context) {
+		proxyType := context.DefaultQuery("type", "tcp")
+
+		var servers []ServerInfo
+		if result := c.DB.Find(&servers); result.Error != nil {
+			context.JSON(http.StatusInternalServerError, gin.H{
+				"code": SaveError,
+				"msg":  "Failed to query servers",
+			})
+			return
+		}
+
+		results := make([][]ServerProxy, len(servers))
+		errs := make(map[string]string)
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for i, server := range servers {
+			wg.Add(1)
+			go func(i int, server ServerInfo) {
+				defer wg.Done()
+				ctx, cancel := gocontext.WithTimeout(gocontext.Background(), overviewServerTimeout)
+				defer cancel()
+				client, err := c.frpsClients.Get(server)
+				var proxies []frpsclient.ProxyStats
+				if err == nil {
+					proxies, err = client.Proxies(ctx, proxyType)
+				}
+				if err != nil {
+					mu.Lock()
+					errs[server.Name] = err.Error()
+					mu.Unlock()
+					return
+				}
+				for _, proxy := range proxies {
+					results[i] = append(results[i], ServerProxy{Server: server.Name, ProxyStats: proxy})
+				}
+			}(i, server)
+		}
+		wg.Wait()
+
+		proxies := make([]ServerProxy, 0)
+		for _, result := range results {
+			proxies = append(proxies, result...)
+		}
+		count := len(proxies)
+
+		page, _ := strconv.Atoi(context.DefaultQuery("page", "1"))
+		limit, _ := strconv.Atoi(context.DefaultQuery("limit", "0"))
+		if page > 0 && limit > 0 {
+			start := min((page-1)*limit, count)
+			proxies = proxies[start:min(start+limit, count)]
+		}
+
+		context.JSON(http.StatusOK, gin.H{
+			"code":   0,
+			"msg":    "query proxies success",
+			"count":  count,
+			"data":   proxies,
+			"errors": errs,
+		})
+	}
+}
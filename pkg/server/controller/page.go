@@ -145,6 +145,58 @@ func (c *HandleController) MakeIndexFunc() func(context *gin.Context) {
 			"PleaseInputConfigTemplate":    ginI18n.MustGetMessage(context, "PleaseInputConfigTemplate"), // 新增
 			"ExportConfig":                 ginI18n.MustGetMessage(context, "ExportConfig"),              // 新增
 			"EditConfigTemplate":           ginI18n.MustGetMessage(context, "EditConfigTemplate"),        // 新增
+			"Schedule":                     ginI18n.MustGetMessage(context, "Schedule"),
+			"ScheduleEnable":               ginI18n.MustGetMessage(context, "Schedule enable"),
+			"ScheduleDays":                 ginI18n.MustGetMessage(context, "Schedule days"),
+			"ScheduleTime":                 ginI18n.MustGetMessage(context, "Schedule time"),
+			"ScheduleTimezone":             ginI18n.MustGetMessage(context, "Schedule timezone"),
+			"PluginPath":                   ginI18n.MustGetMessage(context, "Plugin Path"),
+			"RotatePluginKey":              ginI18n.MustGetMessage(context, "Rotate plugin key"),
+			"Servers":                      ginI18n.MustGetMessage(context, "Servers"),
+			"AddServer":                    ginI18n.MustGetMessage(context, "Add server"),
+			"Policy":                       ginI18n.MustGetMessage(context, "Policy"),
+			"ForceEncryption":              ginI18n.MustGetMessage(context, "Force encryption"),
+			"ForceCompression":             ginI18n.MustGetMessage(context, "Force compression"),
+			"BandwidthLimit":               ginI18n.MustGetMessage(context, "Bandwidth limit"),
+			"PrefixProxyName":              ginI18n.MustGetMessage(context, "Prefix proxy name"),
+			"PinRemotePort":                ginI18n.MustGetMessage(context, "Pin remote port"),
+			"PluginLogs":                   ginI18n.MustGetMessage(context, "Plugin Logs"),
+			"Op":                           ginI18n.MustGetMessage(context, "Op"),
+			"Result":                       ginI18n.MustGetMessage(context, "Result"),
+			"Accepted":                     ginI18n.MustGetMessage(context, "Accepted"),
+			"Rejected":                     ginI18n.MustGetMessage(context, "Rejected"),
+			"ProxyName":                    ginI18n.MustGetMessage(context, "Proxy Name"),
+			"All":                          ginI18n.MustGetMessage(context, "All"),
+			"StartTime":                    ginI18n.MustGetMessage(context, "Start time"),
+			"EndTime":                      ginI18n.MustGetMessage(context, "End time"),
+			"AdminAudits":                  ginI18n.MustGetMessage(context, "Admin Audits"),
+			"Actor":                        ginI18n.MustGetMessage(context, "Actor"),
+			"Action":                       ginI18n.MustGetMessage(context, "Action"),
+			"Target":                       ginI18n.MustGetMessage(context, "Target"),
+			"Export":                       ginI18n.MustGetMessage(context, "Export"),
+			"Quota":                        ginI18n.MustGetMessage(context, "Quota"),
+			"QuotaResetDay":                ginI18n.MustGetMessage(context, "Quota reset day"),
+			"QuotaUsed":                    ginI18n.MustGetMessage(context, "Quota used"),
+			"TopUp":                        ginI18n.MustGetMessage(context, "Top up"),
+			"TopUpAmount":                  ginI18n.MustGetMessage(context, "Top up amount"),
+			"Overview":                     ginI18n.MustGetMessage(context, "Overview"),
+			"ServerStatus":                 ginI18n.MustGetMessage(context, "Server Status"),
+			"DashboardTls":                 ginI18n.MustGetMessage(context, "Dashboard TLS"),
+			"EditDashboard":                ginI18n.MustGetMessage(context, "Edit dashboard"),
+			"DashboardAddr":                ginI18n.MustGetMessage(context, "Dashboard address"),
+			"DashboardPort":                ginI18n.MustGetMessage(context, "Dashboard port"),
+			"DashboardUser":                ginI18n.MustGetMessage(context, "Dashboard user"),
+			"DashboardPwd":                 ginI18n.MustGetMessage(context, "Dashboard password"),
+			"CaCert":                       ginI18n.MustGetMessage(context, "CA certificate"),
+			"CertFingerprint":              ginI18n.MustGetMessage(context, "Certificate fingerprint"),
+			"ClientCert":                   ginI18n.MustGetMessage(context, "Client certificate"),
+			"ClientKey":                    ginI18n.MustGetMessage(context, "Client key"),
+			"SkipCertVerify":               ginI18n.MustGetMessage(context, "Skip certificate verification"),
+			"Kick":                         ginI18n.MustGetMessage(context, "Kick"),
+			"OfflineProxies":               ginI18n.MustGetMessage(context, "Offline proxies"),
+			"ClearOfflineProxies":          ginI18n.MustGetMessage(context, "Clear offline proxies"),
+			"SubdomainClaimLimit":          ginI18n.MustGetMessage(context, "Subdomain claim limit"),
+			"GlobalDefault":                ginI18n.MustGetMessage(context, "Global default"),
 		})
 	}
 }
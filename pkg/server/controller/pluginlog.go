@@ -0,0 +1,209 @@
+package controller
+
+import (
+	"frps-panel/pkg/server/model"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPluginLogRetentionDays = 30
+	defaultPluginLogMaxRows       = 100000
+	pluginLogQueueSize            = 1024
+	pluginLogBatchSize            = 100
+	pluginLogFlushInterval        = time.Second
+	pluginLogPruneInterval        = time.Hour
+)
+
+// pluginLogger 异步写入插件的判定日志, 并定期按保留天数和最大条数清理
+type pluginLogger struct {
+	db            *gorm.DB
+	accepts       bool
+	retentionDays int
+	maxRows       int
+	entries       chan model.PluginLog
+}
+
+func newPluginLogger(db *gorm.DB, common CommonInfo) *pluginLogger {
+	if db == nil {
+		return nil
+	}
+	l := &pluginLogger{
+		db:            db,
+		accepts:       common.PluginLogAccepts,
+		retentionDays: common.PluginLogRetentionDays,
+		maxRows:       common.PluginLogMaxRows,
+		entries:       make(chan model.PluginLog, pluginLogQueueSize),
+	}
+	if l.retentionDays == 0 {
+		l.retentionDays = defaultPluginLogRetentionDays
+	}
+	if l.maxRows == 0 {
+		l.maxRows = defaultPluginLogMaxRows
+	}
+	go l.run()
+	go l.pruneLoop()
+	return l
+}
+
+// Record 将判定放入写入队列, 队列满时丢弃, 不阻塞插件请求
+func (l *pluginLogger) Record(entry model.PluginLog) {
+	if l == nil || (!entry.Reject && !l.accepts) {
+		return
+	}
+	select {
+	case l.entries <- entry:
+	default:
+		log.Printf("plugin log queue is full, drop %s log of user [%s]", entry.Op, entry.User)
+	}
+}
+
+func (l *pluginLogger) run() {
+	ticker := time.NewTicker(pluginLogFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]model.PluginLog, 0, pluginLogBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if result := l.db.CreateInBatches(batch, pluginLogBatchSize); result.Error != nil {
+			log.Printf("failed to save %d plugin logs: %v", len(batch), result.Error)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case entry := <-l.entries:
+			batch = append(batch, entry)
+			if len(batch) >= pluginLogBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (l *pluginLogger) pruneLoop() {
+	for {
+		l.prune()
+		time.Sleep(pluginLogPruneInterval)
+	}
+}
+
+// prune 删除超过保留天数或超过最大条数的日志, 负数表示不限制
+func (l *pluginLogger) prune() {
+	if l.retentionDays > 0 {
+		before := time.Now().AddDate(0, 0, -l.retentionDays)
+		if result := l.db.Unscoped().Where("created_at < ?", before).Delete(&model.PluginLog{}); result.Error != nil {
+			log.Printf("failed to prune plugin logs: %v", result.Error)
+		} else if result.RowsAffected > 0 {
+			log.Printf("pruned %d plugin logs older than %d days", result.RowsAffected, l.retentionDays)
+		}
+	}
+	if l.maxRows > 0 {
+		var boundary model.PluginLog
+		result := l.db.Unscoped().Order("id desc").Offset(l.maxRows).Limit(1).Find(&boundary)
+		if result.Error == nil && result.RowsAffected > 0 {
+			if result := l.db.Unscoped().Where("id <= ?", boundary.ID).Delete(&model.PluginLog{}); result.Error != nil {
+				log.Printf("failed to prune plugin logs: %v", result.Error)
+			} else {
+				log.Printf("pruned %d plugin logs beyond %d rows", result.RowsAffected, l.maxRows)
+			}
+		}
+	}
+}
+
+type PluginLogInfo struct {
+	Id         uint   `json:"id"`
+	Time       string `json:"time"`
+	Op         string `json:"op"`
+	User       string `json:"user"`
+	Server     string `json:"server"`
+	ProxyName  string `json:"proxy_name"`
+	ProxyType  string `json:"proxy_type"`
+	RunID      string `json:"run_id"`
+	ClientAddr string `json:"client_addr"`
+	Reject     bool   `json:"reject"`
+	Reason     string `json:"reason"`
+}
+
+// 查询插件判定日志
+func (c *HandleController) MakeQueryPluginLogsFunc() func(context *gin.Context) {
+	return func(context *gin.Context) {
+		query := c.DB.Model(&model.PluginLog{})
+		if op := trimString(context.Query("op")); op != "" {
+			query = query.Where("op = ?", op)
+		}
+		if user := trimString(context.Query("user")); user != "" {
+			query = query.Where("user LIKE ?", "%"+user+"%")
+		}
+		if server := trimString(context.Query("server")); server != "" {
+			query = query.Where("server = ?", server)
+		}
+		if proxyName := trimString(context.Query("proxy_name")); proxyName != "" {
+			query = query.Where("proxy_name LIKE ?", "%"+proxyName+"%")
+		}
+		if reject := context.Query("reject"); reject != "" {
+			query = query.Where("reject = ?", reject == "true")
+		}
+		if start := trimString(context.Query("start")); start != "" {
+			query = query.Where("created_at >= ?", start)
+		}
+		if end := trimString(context.Query("end")); end != "" {
+			query = query.Where("created_at <= ?", end)
+		}
+
+		var count int64
+		query.Count(&count)
+
+		page, _ := strconv.Atoi(context.DefaultQuery("page", "1"))
+		limit, _ := strconv.Atoi(context.DefaultQuery("limit", "20"))
+		if page < 1 {
+			page = 1
+		}
+		if limit < 1 || limit > 1000 {
+			limit = 20
+		}
+
+		var logs []model.PluginLog
+		if result := query.Order("id desc").Offset((page - 1) * limit).Limit(limit).Find(&logs); result.Error != nil {
+			context.JSON(http.StatusInternalServerError, gin.H{
+				"code": SaveError,
+				"msg":  "Failed to query plugin logs: " + result.Error.Error(),
+			})
+			return
+		}
+
+		data := make([]PluginLogInfo, 0, len(logs))
+		for _, entry := range logs {
+			data = append(data, PluginLogInfo{
+				Id:         entry.ID,
+				Time:       entry.CreatedAt.Format("2006-01-02 15:04:05"),
+				Op:         entry.Op,
+				User:       entry.User,
+				Server:     entry.Server,
+				ProxyName:  entry.ProxyName,
+				ProxyType:  entry.ProxyType,
+				RunID:      entry.RunID,
+				ClientAddr: entry.ClientAddr,
+				Reject:     entry.Reject,
+				Reason:     entry.Reason,
+			})
+		}
+
+		context.JSON(http.StatusOK, gin.H{
+			"code":  0,
+			"msg":   "query plugin logs success",
+			"count": count,
+			"data":  data,
+		})
+	}
+}
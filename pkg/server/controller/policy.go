@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/fatedier/frp/pkg/config/types"
+	plugin "github.com/fatedier/frp/pkg/plugin/server"
+)
+
+// firstAllocatedPort 返回分配中的第一个端口, 端口范围取起始端口
+func firstAllocatedPort(ports []any) int {
+	for _, port := range ports {
+		switch v := port.(type) {
+		case int:
+			return v
+		case float64:
+			return int(v)
+		case string:
+			start, _, _ := strings.Cut(v, "-")
+			if p, err := strconv.Atoi(trimString(start)); err == nil {
+				return p
+			}
+		}
+	}
+	return 0
+}
+
+// Apply 按策略改写新建代理的内容, 返回内容是否被修改
+func (p *ProxyPolicy) Apply(content *plugin.NewProxyContent, allocation ServerAllocation) bool {
+	if p == nil {
+		return false
+	}
+	changed := false
+
+	if p.ForceEncryption && !content.UseEncryption {
+		content.UseEncryption = true
+		changed = true
+	}
+	if p.ForceCompression && !content.UseCompression {
+		content.UseCompression = true
+		changed = true
+	}
+	if limit := trimString(p.BandwidthLimit); limit != "" && content.BandwidthLimit != limit {
+		content.BandwidthLimit = limit
+		content.BandwidthLimitMode = types.BandwidthLimitModeServer
+		changed = true
+	}
+	if prefix := content.User.User + "."; p.PrefixProxyName && content.User.User != "" && !strings.HasPrefix(content.ProxyName, prefix) {
+		content.ProxyName = prefix + content.ProxyName
+		changed = true
+	}
+	if p.PinRemotePort && content.RemotePort == 0 && (content.ProxyType == "tcp" || content.ProxyType == "udp") {
+		if port := firstAllocatedPort(allocation.Ports); port > 0 {
+			content.RemotePort = port
+			changed = true
+		}
+	}
+	return changed
+}
+
+// sameBandwidth 判断上下行档位是否相同, 都为空表示不限速
+func sameBandwidth(upload string, download string) bool {
+	upload, download = trimString(upload), trimString(download)
+	if upload == "" || download == "" {
+		return upload == download
+	}
+	up, err := types.NewBandwidthQuantity(upload)
+	if err != nil {
+		return false
+	}
+	down, err := types.NewBandwidthQuantity(download)
+	if err != nil {
+		return false
+	}
+	return up.Bytes() == down.Bytes()
+}
+
+// bandwidthPlan 返回用户带宽档位中较严格的一个, frps 对代理的上下行共用同一个限速, 保存时已要求两者相同
+func (info UserTokenInfo) bandwidthPlan() (types.BandwidthQuantity, bool) {
+	var plan types.BandwidthQuantity
+	found := false
+	for _, limit := range []string{info.BandwidthUpload, info.BandwidthDownload} {
+		if trimString(limit) == "" {
+			continue
+		}
+		quantity, err := types.NewBandwidthQuantity(limit)
+		if err != nil || quantity.Bytes() <= 0 {
+			continue
+		}
+		if !found || quantity.Bytes() < plan.Bytes() {
+			plan = quantity
+			found = true
+		}
+	}
+	return plan, found
+}
+
+// checkBandwidthPlan 拒绝声明了高于用户档位带宽限制的代理
+func checkBandwidthPlan(content *plugin.NewProxyContent, plan types.BandwidthQuantity) error {
+	if trimString(content.BandwidthLimit) == "" {
+		return nil
+	}
+	declared, err := types.NewBandwidthQuantity(content.BandwidthLimit)
+	if err != nil {
+		return fmt.Errorf("bandwidth limit [%s] format error", content.BandwidthLimit)
+	}
+	if declared.Bytes() > plan.Bytes() {
+		return fmt.Errorf("bandwidth limit [%s] is higher than the plan [%s]", content.BandwidthLimit, plan.String())
+	}
+	return nil
+}
+
+// applyBandwidthPlan 将用户档位下发到代理, 并由 frps 端执行限速, 返回内容是否被修改
+func applyBandwidthPlan(content *plugin.NewProxyContent, plan types.BandwidthQuantity) bool {
+	changed := false
+	if trimString(content.BandwidthLimit) == "" {
+		content.BandwidthLimit = plan.String()
+		changed = true
+	} else if declared, err := types.NewBandwidthQuantity(content.BandwidthLimit); err != nil || declared.Bytes() > plan.Bytes() {
+		// 策略中设置的限速高于档位时以档位为准
+		content.BandwidthLimit = plan.String()
+		changed = true
+	}
+	if content.BandwidthLimitMode != types.BandwidthLimitModeServer {
+		content.BandwidthLimitMode = types.BandwidthLimitModeServer
+		changed = true
+	}
+	return changed
+}
@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// defaultProxyAllow 是默认允许通过 /proxy 转发的 frps dashboard api, {name} 匹配一段任意路径.
+// 带查询参数的规则只匹配参数完全相同的请求, frps 的 dashboard 没有 PUT 接口, 只有清理离线代理一个修改操作 (需要 frps v0.53.0 及以上)
+var defaultProxyAllow = []string{
+	"GET /api/serverinfo",
+	"GET /api/proxy/{type}",
+	"GET /api/proxy/{type}/{name}",
+	"GET /api/traffic/{name}",
+	"DELETE /api/proxies?status=offline",
+}
+
+type proxyAllowRule struct {
+	method   string
+	segments []string
+	// query 不为 nil 时请求的查询参数必须与之完全相同
+	query url.Values
+}
+
+// proxyAllowList 是允许转发的方法和路径
+type proxyAllowList []proxyAllowRule
+
+// newProxyAllowList 解析 "METHOD /path" 格式的规则, 配置中的规则追加在默认规则之后
+func newProxyAllowList(extra []string) (proxyAllowList, error) {
+	var list proxyAllowList
+	for _, entry := range append(append([]string{}, defaultProxyAllow...), extra...) {
+		fields := strings.Fields(entry)
+		if len(fields) != 2 || !strings.HasPrefix(fields[1], "/") {
+			return nil, fmt.Errorf("invalid proxy allow rule [%s], expected \"METHOD /path\"", entry)
+		}
+		method := strings.ToUpper(fields[0])
+		switch method {
+		case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete:
+		default:
+			return nil, fmt.Errorf("unsupported method in proxy allow rule [%s]", entry)
+		}
+		path, rawQuery, hasQuery := strings.Cut(fields[1], "?")
+		rule := proxyAllowRule{method: method, segments: strings.Split(strings.Trim(path, "/"), "/")}
+		if hasQuery {
+			query, err := url.ParseQuery(rawQuery)
+			if err != nil {
+				return nil, fmt.Errorf("invalid query in proxy allow rule [%s]: %v", entry, err)
+			}
+			rule.query = query
+		}
+		list = append(list, rule)
+	}
+	return list, nil
+}
+
+// Allowed 判断请求的方法、路径和查询参数是否在允许列表中
+func (l proxyAllowList) Allowed(method string, path string, query url.Values) bool {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for _, segment := range segments {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+	}
+	for _, rule := range l {
+		if rule.method == method && rule.match(segments) && rule.matchQuery(query) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r proxyAllowRule) match(segments []string) bool {
+	if len(segments) != len(r.segments) {
+		return false
+	}
+	for i, segment := range r.segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			continue
+		}
+		if segment != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (r proxyAllowRule) matchQuery(query url.Values) bool {
+	if r.query == nil {
+		return true
+	}
+	if len(query) != len(r.query) {
+		return false
+	}
+	for key, values := range r.query {
+		got := query[key]
+		if len(got) != len(values) {
+			return false
+		}
+		for i := range values {
+			if got[i] != values[i] {
+				return false
+			}
+		}
+	}
+	return true
+}
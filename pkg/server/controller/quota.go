@@ -0,0 +1,193 @@
+package controller
+
+import (
+	"fmt"
+	"frps-panel/pkg/server/model"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var quotaUnits = map[string]float64{
+	"MB": 1 << 20,
+	"GB": 1 << 30,
+	"TB": 1 << 40,
+}
+
+// parseQuota 将 100GB 这样的配额转换为字节数
+func parseQuota(quota string) (int64, error) {
+	quota = trimString(quota)
+	if !quotaFormat.MatchString(quota) {
+		return 0, fmt.Errorf("quota [%s] format error", quota)
+	}
+	unit := quota[len(quota)-2:]
+	value, err := strconv.ParseFloat(strings.TrimSuffix(quota, unit), 64)
+	if err != nil {
+		return 0, err
+	}
+	return int64(value * quotaUnits[unit]), nil
+}
+
+// quotaCycleStart 返回 now 所在配额周期的第一天, 重置日未设置时为每月 1 号
+func quotaCycleStart(now time.Time, resetDay int) time.Time {
+	if resetDay < 1 || resetDay > 28 {
+		resetDay = 1
+	}
+	start := time.Date(now.Year(), now.Month(), resetDay, 0, 0, 0, 0, now.Location())
+	if now.Before(start) {
+		start = start.AddDate(0, -1, 0)
+	}
+	return start
+}
+
+// quotaExceeded 判断用户本周期的流量是否已超过配额与充值之和
+func (info UserTokenInfo) quotaExceeded() (bool, string) {
+	if trimString(info.Quota) == "" {
+		return false, ""
+	}
+	limit, err := parseQuota(info.Quota)
+	if err != nil {
+		return false, ""
+	}
+	if info.QuotaUsed < limit+info.QuotaTopUp {
+		return false, ""
+	}
+	reset := quotaCycleStart(time.Now(), info.QuotaResetDay).AddDate(0, 1, 0)
+	return true, fmt.Sprintf("user [%s] exceeded the monthly traffic quota [%s], resets on %s",
+		info.User, info.Quota, reset.Format(trafficDayFormat))
+}
+
+// updateQuotaUsage 按流量记录重新计算设置了配额的用户在本周期的用量, 进入新周期时清空充值
+func (t *trafficCollector) updateQuotaUsage() {
+	var users []model.UserToken
+	if result := t.db.Where("quota <> ''").Find(&users); result.Error != nil {
+		log.Printf("failed to query users with quota: %v", result.Error)
+		return
+	}
+
+	now := time.Now()
+	for _, user := range users {
+		cycle := quotaCycleStart(now, user.QuotaResetDay).Format(trafficDayFormat)
+		var used int64
+		result := t.db.Model(&model.TrafficDaily{}).
+			Select("COALESCE(SUM(traffic_in + traffic_out), 0)").
+			Where("user = ? AND day >= ?", user.User, cycle).
+			Scan(&used)
+		if result.Error != nil {
+			log.Printf("failed to sum traffic of user [%s]: %v", user.User, result.Error)
+			continue
+		}
+
+		if used == user.QuotaUsed && cycle == user.QuotaCycle {
+			continue
+		}
+		// 只在进入新周期时清空充值, 条件中带上周期, 避免覆盖采集期间管理员的充值
+		if cycle != user.QuotaCycle {
+			result = t.db.Model(&model.UserToken{}).Where("user = ? AND quota_cycle <> ?", user.User, cycle).Updates(map[string]any{
+				"quota_top_up": 0,
+				"quota_cycle":  cycle,
+			})
+			if result.Error != nil {
+				log.Printf("failed to reset quota cycle of user [%s]: %v", user.User, result.Error)
+				continue
+			}
+		}
+		if result = t.db.Model(&model.UserToken{}).Where("user = ?", user.User).Update("quota_used", used); result.Error != nil {
+			log.Printf("failed to update quota usage of user [%s]: %v", user.User, result.Error)
+			continue
+		}
+		t.cache.Invalidate(user.User)
+	}
+}
+
+// topUpQuota 在数据库中累加本周期的充值, 周期已变化时先清空上个周期的充值
+func (c *HandleController) topUpQuota(user string, cycle string, amount int64) *gorm.DB {
+	var result *gorm.DB
+	// 采集可能同时进入新周期, 两个条件更新都没有命中时再试一次
+	for i := 0; i < 2; i++ {
+		result = c.DB.Model(&model.UserToken{}).Where("user = ? AND quota_cycle = ?", user, cycle).
+			Update("quota_top_up", gorm.Expr("quota_top_up + ?", amount))
+		if result.Error != nil || result.RowsAffected > 0 {
+			return result
+		}
+		result = c.DB.Model(&model.UserToken{}).Where("user = ? AND quota_cycle <> ?", user, cycle).Updates(map[string]any{
+			"quota_top_up": amount,
+			"quota_cycle":  cycle,
+		})
+		if result.Error != nil || result.RowsAffected > 0 {
+			return result
+		}
+	}
+	return result
+}
+
+type QuotaTopUp struct {
+	User   string `json:"user"`
+	Amount string `json:"amount"`
+}
+
+// 为用户本周期的流量配额充值
+func (c *HandleController) MakeTopUpQuotaFunc() func(context *gin.Context) {
+	return func(context *gin.Context) {
+		var req QuotaTopUp
+		response := OperationResponse{
+			Success: true,
+			Code:    Success,
+			Message: "top up success",
+		}
+		if err := context.BindJSON(&req); err != nil {
+			response.Success = false
+			response.Code = ParamError
+			response.Message = fmt.Sprintf("top up failed, param error : %v", err)
+			context.JSON(http.StatusOK, &response)
+			return
+		}
+
+		amount, err := parseQuota(req.Amount)
+		if err != nil || amount <= 0 {
+			response.Success = false
+			response.Code = QuotaFormatError
+			response.Message = fmt.Sprintf("top up failed, amount [%s] format error", req.Amount)
+			context.JSON(http.StatusOK, &response)
+			return
+		}
+
+		var userToken model.UserToken
+		if result := c.DB.Where("user = ?", req.User).First(&userToken); result.Error != nil {
+			response.Success = false
+			response.Code = UserNotExist
+			response.Message = fmt.Sprintf("top up failed, user [%s] not exist", req.User)
+			context.JSON(http.StatusOK, &response)
+			return
+		}
+
+		// 充值只对当前周期有效, 同时写入周期, 避免采集时被当作上个周期的充值清空
+		cycle := quotaCycleStart(time.Now(), userToken.QuotaResetDay).Format(trafficDayFormat)
+		result := c.topUpQuota(req.User, cycle, amount)
+		c.userCache.Invalidate(req.User)
+		if result.Error == nil && result.RowsAffected == 0 {
+			response.Success = false
+			response.Code = SaveError
+			response.Message = fmt.Sprintf("top up failed, user [%s] was changed concurrently, please retry", req.User)
+			log.Printf(response.Message)
+			context.JSON(http.StatusOK, &response)
+			return
+		}
+		if result.Error != nil {
+			response.Success = false
+			response.Code = SaveError
+			response.Message = fmt.Sprintf("top up failed, db error : %v", result.Error)
+			log.Printf(response.Message)
+			context.JSON(http.StatusOK, &response)
+			return
+		}
+
+		c.recordAudit(context, AuditQuotaTopUp, req.User, req)
+		context.JSON(http.StatusOK, &response)
+	}
+}
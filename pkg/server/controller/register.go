@@ -1,6 +1,8 @@
 package controller
 
 import (
+	"frps-panel/pkg/frpsclient"
+	"log"
 	"os"
 	"path/filepath"
 
@@ -16,9 +18,36 @@ type HandleController struct {
 	CurrentDashboardIndex int
 	DB                    *gorm.DB
 	Database              DatabaseConfig
+
+	userCache *userCache
+	// 插件请求识别出的服务器
+	pluginServers *pluginServerCache
+	pluginLogger  *pluginLogger
+
+	frpsClients      *serverClients
+	trafficCollector *trafficCollector
+	healthChecker    *healthChecker
+
+	sessions   *sessionTracker
+	proxyAllow proxyAllowList
+
+	// 静态资源目录, 只读, 其中的 config_template.json 为内置的默认模板
+	assetsDir string
 }
 
 func NewHandleController(config *HandleController) *HandleController {
+	config.userCache = newUserCache(config.CommonInfo.UserCacheTTL)
+	config.pluginServers = newPluginServerCache(config.CommonInfo.UserCacheTTL)
+	config.pluginLogger = newPluginLogger(config.DB, config.CommonInfo)
+	config.frpsClients = &serverClients{pool: frpsclient.NewPool(), secrets: newServerSecrets(config.DB, config.CommonInfo)}
+	config.trafficCollector = newTrafficCollector(config.DB, config.frpsClients, config.CommonInfo.TrafficCollectInterval, config.userCache)
+	config.sessions = newSessionTracker()
+	proxyAllow, err := newProxyAllowList(config.CommonInfo.DashboardProxyAllow)
+	if err != nil {
+		log.Fatalf("invalid dashboard_proxy_allow: %v", err)
+	}
+	config.proxyAllow = proxyAllow
+	config.healthChecker = newHealthChecker(config.DB, config.frpsClients, config.CommonInfo.HealthCheckInterval)
 	return config
 }
 
@@ -28,10 +57,12 @@ func (c *HandleController) Register(rootDir string, engine *gin.Engine) {
 	if err != nil && !os.IsExist(err) {
 		assets = "./assets"
 	}
+	c.assetsDir = assets
 
 	engine.Delims("${", "}")
 	engine.LoadHTMLGlob(filepath.Join(assets, "templates/*"))
-	engine.POST("/handler", c.MakeHandlerFunc())
+	engine.POST(HandlerUrl, c.MakeHandlerFunc())
+	engine.POST(HandlerUrl+"/:key", c.MakeHandlerFunc())
 	engine.Static("/static", filepath.Join(assets, "static"))
 	engine.GET("/lang.json", c.MakeLangFunc())
 	engine.GET(LoginUrl, c.MakeLoginFunc())
@@ -52,16 +83,45 @@ func (c *HandleController) Register(rootDir string, engine *gin.Engine) {
 	adminGroup.POST("/remove", c.MakeRemoveTokensFunc())
 	adminGroup.POST("/disable", c.MakeDisableTokensFunc())
 	adminGroup.POST("/enable", c.MakeEnableTokensFunc())
-	adminGroup.GET("/proxy/*serverApi", c.MakeProxyFunc())
+	adminGroup.Any("/proxy/*serverApi", c.MakeProxyFunc())
 	adminGroup.GET("/dashboards", c.MakeQueryDashboardsFunc())
+	adminGroup.GET("/api/overview", c.MakeOverviewFunc())
+	adminGroup.GET("/api/overview/proxies", c.MakeOverviewProxiesFunc())
+	adminGroup.GET("/api/server_status", c.MakeServerStatusFunc())
+	adminGroup.GET("/api/server_status/history", c.MakeServerStatusHistoryFunc())
+	adminGroup.GET("/api/server_status/badge/:name", c.MakeServerBadgeFunc())
 	adminGroup.POST("/switch_dashboard", c.MakeSwitchDashboardFunc())
+	adminGroup.POST("/rotate_plugin_key", c.MakeRotatePluginKeyFunc())
+	adminGroup.POST("/save_dashboard", c.MakeSaveDashboardFunc())
+	adminGroup.POST("/kick_user", c.MakeKickUserFunc())
+	adminGroup.POST("/unkick_user", c.MakeUnkickUserFunc())
+	adminGroup.POST("/clear_offline_proxies", c.MakeClearOfflineProxiesFunc())
+	adminGroup.POST("/quota/topup", c.MakeTopUpQuotaFunc())
+	adminGroup.GET("/cache_stats", c.MakeCacheStatsFunc())
+	adminGroup.GET("/api/plugin_logs", c.MakeQueryPluginLogsFunc())
+	adminGroup.GET("/api/admin_audits", c.MakeQueryAdminAuditsFunc())
+	adminGroup.GET("/api/admin_audits/export", c.MakeExportAdminAuditsFunc())
+	adminGroup.GET("/api/frpc_config", c.MakeFrpcConfigFunc())
+	adminGroup.GET("/api/frpc_bundle", c.MakeFrpcBundleFunc())
 	adminGroup.GET("/get_max_port", c.MakeGetMaxPortFunc())
 	adminGroup.GET("/get_all_max_ports", c.MakeGetAllMaxPortsFunc())
+	adminGroup.GET("/api/config_template", c.MakeQueryConfigTemplateFunc())
+	adminGroup.GET("/api/config_templates", c.MakeQueryConfigTemplateVersionsFunc())
+	adminGroup.GET("/api/config_templates/diff", c.MakeDiffConfigTemplateFunc())
 	adminGroup.POST("/save_config_template", c.MakeSaveConfigTemplateFunc())
+	adminGroup.POST("/rollback_config_template", c.MakeRollbackConfigTemplateFunc())
 
 	// 普通用户API路由
 	userApiGroup := engine.Group("/api/user", c.BasicAuth())
 	userApiGroup.GET("/info", c.MakeQueryUserInfoFunc())       // 新增获取用户信息的API
 	userApiGroup.GET("/proxies", c.MakeQueryUserProxiesFunc()) // 新增获取用户代理列表的API
 	userApiGroup.GET("/dashboards", c.MakeQueryDashboardsFunc())
+	userApiGroup.GET("/subdomains", c.MakeQuerySubdomainClaimsFunc())
+	userApiGroup.POST("/subdomains/claim", c.MakeClaimSubdomainFunc())
+	userApiGroup.POST("/subdomains/release", c.MakeReleaseSubdomainFunc())
+	userApiGroup.GET("/traffic/daily", c.MakeQueryDailyTrafficFunc())
+	userApiGroup.GET("/traffic/monthly", c.MakeQueryMonthlyTrafficFunc())
+	userApiGroup.GET("/frpc_config", c.MakeFrpcConfigFunc())
+	userApiGroup.GET("/bundle", c.MakeFrpcBundleFunc())
+	userApiGroup.POST("/rotate-token", c.MakeRotateTokenFunc())
 }
@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+)
+
+// location 返回时间表所使用的时区, 未设置时使用本地时区
+func (s *AccessSchedule) location() (*time.Location, error) {
+	if trimString(s.Timezone) == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(trimString(s.Timezone))
+}
+
+// validate 检查时间表的星期、起止时间与时区是否合法
+func (s *AccessSchedule) validate() error {
+	for _, day := range s.Days {
+		if day < int(time.Sunday) || day > int(time.Saturday) {
+			return fmt.Errorf("day [%d] out of range 0-6", day)
+		}
+	}
+	if (s.From == "") != (s.To == "") {
+		return fmt.Errorf("from and to must be set together")
+	}
+	if s.From != "" && !scheduleFormat.MatchString(s.From) {
+		return fmt.Errorf("from [%s] format error", s.From)
+	}
+	if s.To != "" && !scheduleFormat.MatchString(s.To) {
+		return fmt.Errorf("to [%s] format error", s.To)
+	}
+	if _, err := s.location(); err != nil {
+		return fmt.Errorf("timezone [%s] is unknown", s.Timezone)
+	}
+	return nil
+}
+
+func (s *AccessSchedule) allowsDay(day time.Weekday) bool {
+	if len(s.Days) == 0 {
+		return true
+	}
+	for _, d := range s.Days {
+		if d == int(day) {
+			return true
+		}
+	}
+	return false
+}
+
+// window 返回从 date 当天开始的访问窗口
+func (s *AccessSchedule) window(date time.Time) (time.Time, time.Time) {
+	y, m, d := date.Date()
+	if s.From == "" {
+		start := time.Date(y, m, d, 0, 0, 0, 0, date.Location())
+		return start, start.AddDate(0, 0, 1)
+	}
+	from, _ := time.Parse("15:04", s.From)
+	to, _ := time.Parse("15:04", s.To)
+	start := time.Date(y, m, d, from.Hour(), from.Minute(), 0, 0, date.Location())
+	end := time.Date(y, m, d, to.Hour(), to.Minute(), 0, 0, date.Location())
+	if !end.After(start) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return start, end
+}
+
+// Check 判断 now 是否处于访问窗口内, 不在窗口内时返回下一次开放的时间
+func (s *AccessSchedule) Check(now time.Time) (bool, time.Time, error) {
+	loc, err := s.location()
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	now = now.In(loc)
+
+	// 前一天开始的跨午夜窗口也可能覆盖当前时间
+	for offset := -1; offset <= 0; offset++ {
+		date := now.AddDate(0, 0, offset)
+		if !s.allowsDay(date.Weekday()) {
+			continue
+		}
+		start, end := s.window(date)
+		if !now.Before(start) && now.Before(end) {
+			return true, time.Time{}, nil
+		}
+	}
+
+	for offset := 0; offset <= 7; offset++ {
+		date := now.AddDate(0, 0, offset)
+		if !s.allowsDay(date.Weekday()) {
+			continue
+		}
+		start, _ := s.window(date)
+		if start.After(now) {
+			return false, start, nil
+		}
+	}
+	return false, time.Time{}, nil
+}
+
+// JudgeSchedule 判断用户当前是否允许建立隧道
+func JudgeSchedule(user string, schedule *AccessSchedule, now time.Time) (bool, string) {
+	if schedule == nil {
+		return true, ""
+	}
+	allowed, reopen, err := schedule.Check(now)
+	if err != nil {
+		return false, fmt.Sprintf("user [%s] access schedule is invalid: %v", user, err)
+	}
+	if allowed {
+		return true, ""
+	}
+	if reopen.IsZero() {
+		return false, fmt.Sprintf("user [%s] is outside its access schedule", user)
+	}
+	return false, fmt.Sprintf("user [%s] is outside its access schedule, access reopens at %s",
+		user, reopen.Format("2006-01-02 15:04 MST"))
+}
@@ -0,0 +1,197 @@
+package controller
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"frps-panel/pkg/frpsclient"
+	"frps-panel/pkg/server/model"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// 加密后的值带有该前缀, 没有前缀的值视为旧版本保存的明文
+	secretPrefix = "enc:v1:"
+	// 环境变量中的密钥优先于配置文件
+	SecretKeyEnv = "FRPS_PANEL_SECRET_KEY"
+)
+
+var errSecretKeyMissing = errors.New("secret key is not configured")
+
+// secretBox 使用 AES-256-GCM 加密保存在数据库中的 dashboard 凭据
+type secretBox struct {
+	aead cipher.AEAD
+}
+
+// SecretKey 返回加密凭据使用的密钥, 环境变量优先
+func SecretKey(common CommonInfo) string {
+	if key := trimString(os.Getenv(SecretKeyEnv)); key != "" {
+		return key
+	}
+	return trimString(common.SecretKey)
+}
+
+// newSecretBox 由密钥派生加密用的 key, 密钥为空时返回 nil, 此时凭据按明文保存
+func newSecretBox(key string) (*secretBox, error) {
+	if key == "" {
+		return nil, nil
+	}
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &secretBox{aead: aead}, nil
+}
+
+func isSealed(value string) bool {
+	return strings.HasPrefix(value, secretPrefix)
+}
+
+// seal 加密一个值, 空值和未配置密钥时原样返回. 接口提交的值总是加密, 即使带有加密前缀;
+// 只有迁移和更换密钥时才按前缀判断是否已加密
+func (b *secretBox) seal(plain string) (string, error) {
+	if plain == "" {
+		return plain, nil
+	}
+	if b == nil {
+		// 明文保存时带前缀的值会在读取时被当作密文
+		if isSealed(plain) {
+			return "", fmt.Errorf("a value starting with %q can only be stored when secret_key is set", secretPrefix)
+		}
+		return plain, nil
+	}
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := b.aead.Seal(nonce, nonce, []byte(plain), nil)
+	return secretPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// open 解密一个值, 明文原样返回
+func (b *secretBox) open(value string) (string, error) {
+	if !isSealed(value) {
+		return value, nil
+	}
+	if b == nil {
+		return "", errSecretKeyMissing
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, secretPrefix))
+	if err != nil || len(sealed) < b.aead.NonceSize() {
+		return "", fmt.Errorf("invalid encrypted value")
+	}
+	nonce, ciphertext := sealed[:b.aead.NonceSize()], sealed[b.aead.NonceSize():]
+	plain, err := b.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value, the secret key may be wrong")
+	}
+	return string(plain), nil
+}
+
+// newServerSecrets 按配置的密钥创建 secretBox, 并加密数据库中仍为明文的凭据
+func newServerSecrets(db *gorm.DB, common CommonInfo) *secretBox {
+	key := SecretKey(common)
+	secrets, err := newSecretBox(key)
+	if err != nil {
+		log.Fatalf("invalid secret key: %v", err)
+	}
+	if secrets == nil {
+		log.Printf("secret_key is not set, dashboard credentials are stored in plain text")
+		return nil
+	}
+	if db != nil {
+		if count, err := SealServerSecrets(db, key, key); err != nil {
+			log.Printf("failed to encrypt dashboard credentials: %v", err)
+		} else if count > 0 {
+			log.Printf("encrypted dashboard credentials of %d servers", count)
+		}
+	}
+	return secrets
+}
+
+// serverClients 解密服务器凭据并从连接池中取出对应的客户端
+type serverClients struct {
+	pool    *frpsclient.Pool
+	secrets *secretBox
+}
+
+func (s *serverClients) Get(server ServerInfo) (*frpsclient.Client, error) {
+	password, err := s.secrets.open(server.DashboardPwd)
+	if err != nil {
+		return nil, fmt.Errorf("dashboard password of server [%s]: %w", server.Name, err)
+	}
+	clientKey, err := s.secrets.open(server.DashboardClientKey)
+	if err != nil {
+		return nil, fmt.Errorf("dashboard client key of server [%s]: %w", server.Name, err)
+	}
+	cfg := server.clientConfig()
+	cfg.Password = password
+	cfg.ClientKey = clientKey
+	return s.pool.Get(cfg)
+}
+
+// SealServerSecrets 用新密钥重新加密所有服务器的凭据, oldKey 为空表示原来是明文,
+// newKey 为空时解密为明文; 两者相同时只加密尚未加密的值. 返回修改的服务器数量
+func SealServerSecrets(db *gorm.DB, oldKey string, newKey string) (int, error) {
+	oldBox, err := newSecretBox(oldKey)
+	if err != nil {
+		return 0, err
+	}
+	newBox, err := newSecretBox(newKey)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var servers []model.ServerInfo
+		if result := tx.Find(&servers); result.Error != nil {
+			return result.Error
+		}
+		for _, server := range servers {
+			updates := map[string]interface{}{}
+			for column, value := range map[string]string{
+				"dashboard_pwd":        server.DashboardPwd,
+				"dashboard_client_key": server.DashboardClientKey,
+			} {
+				if isSealed(value) && oldKey == newKey {
+					continue
+				}
+				plain, err := oldBox.open(value)
+				if err != nil {
+					return fmt.Errorf("%s of server [%s]: %w", column, server.Name, err)
+				}
+				sealed, err := newBox.seal(plain)
+				if err != nil {
+					return err
+				}
+				if sealed != value {
+					updates[column] = sealed
+				}
+			}
+			if len(updates) == 0 {
+				continue
+			}
+			if result := tx.Model(&model.ServerInfo{}).Where("id = ?", server.ID).Updates(updates); result.Error != nil {
+				return result.Error
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
@@ -1,22 +1,25 @@
 package controller
 
 import (
-	"crypto/tls"
-	"encoding/json"
+	gocontext "context"
+	"errors"
 	"fmt"
+	"frps-panel/pkg/frpsclient"
 	"frps-panel/pkg/server/model"
-	"io"
 	"log"
 	"net/http"
-	"os"
-	"path/filepath"
+	"net/url"
 	"strconv"
-	"strings"
+	"time"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
+// 通过 /proxy 转发一个请求的最长时间, 包括读取响应体
+const proxyStreamTimeout = 5 * time.Minute
+
 // 后台获取最大端口
 func (c *HandleController) MakeGetMaxPortFunc() func(context *gin.Context) {
 	return func(context *gin.Context) {
@@ -29,8 +32,8 @@ func (c *HandleController) MakeGetMaxPortFunc() func(context *gin.Context) {
 			return
 		}
 
-		var userTokens []model.UserToken
-		if result := c.DB.Where("server = ?", serverName).Find(&userTokens); result.Error != nil {
+		var userServers []model.UserServer
+		if result := c.DB.Where("server = ?", serverName).Find(&userServers); result.Error != nil {
 			context.JSON(http.StatusInternalServerError, gin.H{
 				"success": false,
 				"message": "Failed to query tokens",
@@ -39,37 +42,13 @@ func (c *HandleController) MakeGetMaxPortFunc() func(context *gin.Context) {
 		}
 
 		maxPort := 0
-		for _, userToken := range userTokens {
-			tokenInfo, err := ToUserTokenInfo(userToken)
+		for _, userServer := range userServers {
+			allocation, err := ToServerAllocation(userServer)
 			if err != nil {
-				log.Printf("Failed to convert user token: %v", err)
+				log.Printf("Failed to convert user server: %v", err)
 				continue
 			}
-			for _, p := range tokenInfo.Ports {
-				switch v := p.(type) {
-				case int:
-					if v > maxPort {
-						maxPort = v
-					}
-				case float64:
-					if int(v) > maxPort {
-						maxPort = int(v)
-					}
-				case string:
-					parts := strings.Split(v, "-")
-					if len(parts) == 2 {
-						endPort, err := strconv.Atoi(strings.TrimSpace(parts[1]))
-						if err == nil && endPort > maxPort {
-							maxPort = endPort
-						}
-					} else {
-						singlePort, err := strconv.Atoi(strings.TrimSpace(v))
-						if err == nil && singlePort > maxPort {
-							maxPort = singlePort
-						}
-					}
-				}
-			}
+			maxPort = max(maxPort, maxAllocatedPort(allocation.Ports))
 		}
 
 		context.JSON(http.StatusOK, gin.H{
@@ -83,8 +62,8 @@ func (c *HandleController) MakeGetMaxPortFunc() func(context *gin.Context) {
 // 后台获取最大端口列表
 func (c *HandleController) MakeGetAllMaxPortsFunc() func(context *gin.Context) {
 	return func(context *gin.Context) {
-		var userTokens []model.UserToken
-		if result := c.DB.Find(&userTokens); result.Error != nil {
+		var userServers []model.UserServer
+		if result := c.DB.Find(&userServers); result.Error != nil {
 			context.JSON(http.StatusInternalServerError, gin.H{
 				"success": false,
 				"message": "Failed to query tokens",
@@ -93,42 +72,13 @@ func (c *HandleController) MakeGetAllMaxPortsFunc() func(context *gin.Context) {
 		}
 
 		maxPortsMap := make(map[string]int)
-		for _, userToken := range userTokens {
-			tokenInfo, err := ToUserTokenInfo(userToken)
+		for _, userServer := range userServers {
+			allocation, err := ToServerAllocation(userServer)
 			if err != nil {
-				log.Printf("Failed to convert user token: %v", err)
+				log.Printf("Failed to convert user server: %v", err)
 				continue
 			}
-			serverName := tokenInfo.Server
-			if _, ok := maxPortsMap[serverName]; !ok {
-				maxPortsMap[serverName] = 0
-			}
-
-			for _, p := range tokenInfo.Ports {
-				switch v := p.(type) {
-				case int:
-					if v > maxPortsMap[serverName] {
-						maxPortsMap[serverName] = v
-					}
-				case float64:
-					if int(v) > maxPortsMap[serverName] {
-						maxPortsMap[serverName] = int(v)
-					}
-				case string:
-					parts := strings.Split(v, "-")
-					if len(parts) == 2 {
-						endPort, err := strconv.Atoi(strings.TrimSpace(parts[1]))
-						if err == nil && endPort > maxPortsMap[serverName] {
-							maxPortsMap[serverName] = endPort
-						}
-					} else {
-						singlePort, err := strconv.Atoi(strings.TrimSpace(v))
-						if err == nil && singlePort > maxPortsMap[serverName] {
-							maxPortsMap[serverName] = singlePort
-						}
-					}
-				}
-			}
+			maxPortsMap[allocation.Server] = max(maxPortsMap[allocation.Server], maxAllocatedPort(allocation.Ports))
 		}
 
 		context.JSON(http.StatusOK, gin.H{
@@ -157,8 +107,17 @@ func (c *HandleController) MakeQueryDashboardsFunc() func(context *gin.Context)
 				Name          string `json:"name"`
 				DashboardAddr string `json:"dashboard_addr"`
 			}
+			currentUser := fmt.Sprintf("%v", session.Get("current_user"))
+			info, err := c.queryUserTokenInfo(currentUser)
+			if err != nil {
+				context.JSON(http.StatusNotFound, gin.H{"success": false, "message": "User info not found"})
+				return
+			}
 			var userDashboards []UserDashboardInfo
 			for _, server := range servers {
+				if _, ok := info.allocationFor(server.Name); !ok {
+					continue
+				}
 				userDashboards = append(userDashboards, UserDashboardInfo{
 					Name:          server.Name,
 					DashboardAddr: server.DashboardAddr,
@@ -174,6 +133,11 @@ func (c *HandleController) MakeQueryDashboardsFunc() func(context *gin.Context)
 		}
 
 		// For admin users, return all dashboard information
+		for i := range servers {
+			servers[i].TlsVerify = servers[i].tlsVerifyMode()
+			servers[i].DashboardPwdSet = servers[i].DashboardPwd != ""
+			servers[i].DashboardClientKeySet = servers[i].DashboardClientKey != ""
+		}
 		context.JSON(http.StatusOK, gin.H{
 			"code":          0,
 			"msg":           "success",
@@ -209,6 +173,7 @@ func (c *HandleController) MakeSwitchDashboardFunc() func(context *gin.Context)
 		}
 
 		c.CurrentDashboardIndex = req.Index
+		c.recordAudit(context, AuditDashboardSwitch, strconv.Itoa(req.Index), gin.H{"index": req.Index})
 		context.JSON(http.StatusOK, gin.H{
 			"success": true,
 			"message": "Dashboard switched successfully",
@@ -216,11 +181,11 @@ func (c *HandleController) MakeSwitchDashboardFunc() func(context *gin.Context)
 	}
 }
 
-// 保存模板信息
-func (c *HandleController) MakeSaveConfigTemplateFunc() func(context *gin.Context) {
+// 重新生成服务器的插件路径密钥
+func (c *HandleController) MakeRotatePluginKeyFunc() func(context *gin.Context) {
 	return func(context *gin.Context) {
 		var req struct {
-			Template string `json:"template"`
+			Name string `json:"name"`
 		}
 		if err := context.BindJSON(&req); err != nil {
 			context.JSON(http.StatusBadRequest, gin.H{
@@ -230,52 +195,177 @@ func (c *HandleController) MakeSaveConfigTemplateFunc() func(context *gin.Contex
 			return
 		}
 
-		// 构建配置模板文件路径
-		assets := filepath.Join("assets", "static", "config_template.json")
-		_, err := os.Stat(assets)
-		if err != nil && !os.IsExist(err) {
-			assets = "./assets/static/config_template.json"
+		var count int64
+		c.DB.Model(&ServerInfo{}).Where("name = ?", req.Name).Count(&count)
+		if count == 0 {
+			context.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("Server [%s] not found", req.Name),
+			})
+			return
 		}
 
-		// 创建JSON对象
-		configTemplate := struct {
-			Template string `json:"template"`
-		}{
-			Template: req.Template,
+		key, err := model.NewPluginKey()
+		if err != nil {
+			context.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "Failed to generate plugin key: " + err.Error(),
+			})
+			return
 		}
 
-		// 将JSON对象转换为字节
-		jsonData, err := json.MarshalIndent(configTemplate, "", "  ")
-		if err != nil {
+		result := c.DB.Model(&ServerInfo{}).Where("name = ?", req.Name).Update("plugin_key", key)
+		c.pluginServers.Invalidate()
+		if result.Error != nil {
 			context.JSON(http.StatusInternalServerError, gin.H{
 				"success": false,
-				"message": "Failed to marshal JSON: " + err.Error(),
+				"message": "Failed to save plugin key: " + result.Error.Error(),
 			})
 			return
 		}
 
-		// 写入文件
-		err = os.WriteFile(assets, jsonData, 0644)
+		// 插件密钥用于识别 frps, 不写入审计记录
+		c.recordAudit(context, AuditPluginKeyRotate, req.Name, gin.H{"name": req.Name})
+		context.JSON(http.StatusOK, gin.H{
+			"success":     true,
+			"message":     "Plugin key rotated successfully",
+			"plugin_key":  key,
+			"plugin_path": HandlerUrl + "/" + key,
+		})
+	}
+}
+
+// 保存服务器的 dashboard 设置, 密码和客户端私钥只写不读
+func (c *HandleController) MakeSaveDashboardFunc() func(context *gin.Context) {
+	return func(context *gin.Context) {
+		var req DashboardSave
+		if err := context.BindJSON(&req); err != nil {
+			context.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Invalid request body",
+			})
+			return
+		}
+
+		var server ServerInfo
+		if result := c.DB.Where("name = ?", req.Name).Limit(1).Find(&server); result.Error != nil || result.RowsAffected == 0 {
+			context.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("Server [%s] not found", req.Name),
+			})
+			return
+		}
+
+		req.DashboardAddr = trimString(req.DashboardAddr)
+		if req.DashboardAddr == "" || req.DashboardPort <= 0 || req.DashboardPort > 65535 {
+			context.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "Invalid dashboard address or port",
+			})
+			return
+		}
+		fingerprint, err := frpsclient.NormalizeFingerprint(req.DashboardFingerprint)
 		if err != nil {
+			context.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "Invalid dashboard fingerprint: " + err.Error(),
+			})
+			return
+		}
+
+		secrets := c.frpsClients.secrets
+		password, clientKey := server.DashboardPwd, server.DashboardClientKey
+		if req.DashboardPwd != nil {
+			if password, err = secrets.seal(*req.DashboardPwd); err != nil {
+				context.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Failed to encrypt password: " + err.Error()})
+				return
+			}
+		}
+		if req.DashboardClientKey != nil {
+			if clientKey, err = secrets.seal(trimString(*req.DashboardClientKey)); err != nil {
+				context.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Failed to encrypt client key: " + err.Error()})
+				return
+			}
+		}
+
+		server.DashboardAddr = req.DashboardAddr
+		server.DashboardPort = req.DashboardPort
+		server.DashboardUser = trimString(req.DashboardUser)
+		server.DashboardPwd = password
+		server.DashboardTls = req.DashboardTls
+		server.DashboardCaCert = trimString(req.DashboardCaCert)
+		server.DashboardFingerprint = fingerprint
+		server.DashboardClientCert = trimString(req.DashboardClientCert)
+		server.DashboardClientKey = clientKey
+		server.DashboardInsecure = req.DashboardInsecure
+		// 没有插件密钥的服务器只能使用按 IP 识别的旧路径, 保存时补上
+		if server.PluginKey == "" {
+			if server.PluginKey, err = model.NewPluginKey(); err != nil {
+				context.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Failed to generate plugin key: " + err.Error()})
+				return
+			}
+		}
+
+		// 保存前检查证书和私钥能否正常使用
+		if _, err := c.frpsClients.Get(server); err != nil {
+			context.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+
+		result := c.DB.Model(&ServerInfo{}).Where("name = ?", server.Name).Updates(map[string]interface{}{
+			"dashboard_addr":        server.DashboardAddr,
+			"dashboard_port":        server.DashboardPort,
+			"dashboard_user":        server.DashboardUser,
+			"dashboard_pwd":         server.DashboardPwd,
+			"dashboard_tls":         server.DashboardTls,
+			"dashboard_ca_cert":     server.DashboardCaCert,
+			"dashboard_fingerprint": server.DashboardFingerprint,
+			"dashboard_client_cert": server.DashboardClientCert,
+			"dashboard_client_key":  server.DashboardClientKey,
+			"dashboard_insecure":    server.DashboardInsecure,
+			"plugin_key":            server.PluginKey,
+		})
+		c.pluginServers.Invalidate()
+		if result.Error != nil {
 			context.JSON(http.StatusInternalServerError, gin.H{
 				"success": false,
-				"message": "Failed to write file: " + err.Error(),
+				"message": "Failed to save dashboard: " + result.Error.Error(),
 			})
 			return
 		}
 
+		// 凭据不写入审计记录, 只记录是否修改
+		c.recordAudit(context, AuditDashboardSave, server.Name, gin.H{
+			"dashboard_addr":        server.DashboardAddr,
+			"dashboard_port":        server.DashboardPort,
+			"dashboard_user":        server.DashboardUser,
+			"dashboard_tls":         server.DashboardTls,
+			"dashboard_fingerprint": server.DashboardFingerprint,
+			"dashboard_insecure":    server.DashboardInsecure,
+			"dashboard_pwd_changed": req.DashboardPwd != nil,
+			"client_key_changed":    req.DashboardClientKey != nil,
+		})
 		context.JSON(http.StatusOK, gin.H{
 			"success": true,
-			"message": "Config template saved successfully",
+			"message": "Dashboard saved successfully",
 		})
 	}
 }
 
-// 获取当前服务器的面板信息
+// 转发请求到当前服务器的 dashboard, 只允许列表中的方法和路径, 状态码和响应内容原样返回
 func (c *HandleController) MakeProxyFunc() func(context *gin.Context) {
 	return func(context *gin.Context) {
-		var client *http.Client
-		var protocol string
+		path := context.Param("serverApi")
+		if !c.proxyAllow.Allowed(context.Request.Method, path, context.Request.URL.Query()) {
+			context.JSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("%s %s is not allowed", context.Request.Method, path),
+			})
+			return
+		}
 
 		var servers []ServerInfo
 		if result := c.DB.Find(&servers); result.Error != nil {
@@ -291,69 +381,74 @@ func (c *HandleController) MakeProxyFunc() func(context *gin.Context) {
 			return
 		}
 
-		currentDashboard := servers[c.CurrentDashboardIndex]
-
-		if currentDashboard.DashboardTls {
-			client = &http.Client{
-				Transport: &http.Transport{
-					TLSClientConfig: &tls.Config{
-						InsecureSkipVerify: true,
-					},
-				},
-			}
-			protocol = "https://"
-		} else {
-			client = http.DefaultClient
-			protocol = "http://"
-		}
-
-		res := ProxyResponse{}
-		host := currentDashboard.DashboardAddr
-		port := currentDashboard.DashboardPort
-
-		host, _ = strings.CutPrefix(host, protocol)
-
-		requestUrl := protocol + host + ":" + strconv.Itoa(port) + context.Param("serverApi")
-		request, _ := http.NewRequest("GET", requestUrl, nil)
-		username := currentDashboard.DashboardUser
-		password := currentDashboard.DashboardPwd
-		if trimString(username) != "" && trimString(password) != "" {
-			request.SetBasicAuth(username, password)
-			log.Printf("Proxy to %s", requestUrl)
+		client, err := c.frpsClients.Get(servers[c.CurrentDashboardIndex])
+		if err != nil {
+			log.Print(err)
+			context.JSON(http.StatusBadGateway, gin.H{"success": false, "code": FrpServerError, "message": err.Error()})
+			return
 		}
 
-		response, err := client.Do(request)
-
+		api := (&url.URL{Path: path, RawQuery: context.Request.URL.RawQuery}).RequestURI()
+		// 响应以流的方式转发, 不受 frps 客户端单次请求超时的限制, 只限制整个转发的时间
+		ctx, cancel := gocontext.WithTimeout(context.Request.Context(), proxyStreamTimeout)
+		defer cancel()
+		response, err := client.Do(ctx, context.Request.Method, api, context.Request.Body, context.ContentType())
 		if err != nil {
-			res.Code = FrpServerError
-			res.Success = false
-			res.Message = err.Error()
 			log.Print(err)
-			context.JSON(http.StatusOK, &res)
+			context.JSON(http.StatusBadGateway, gin.H{"success": false, "code": FrpServerError, "message": err.Error()})
 			return
 		}
+		defer response.Body.Close()
+
+		log.Printf("Proxy %s %s to %s: %d", context.Request.Method, api, client, response.StatusCode)
+		context.DataFromReader(response.StatusCode, response.ContentLength, response.Header.Get("Content-Type"), response.Body, nil)
+	}
+}
 
-		res.Code = response.StatusCode
-		body, err := io.ReadAll(response.Body)
+// proxyErrorResponse 把 frps dashboard 的请求错误转换为响应, 非 200 响应保留状态码
+func proxyErrorResponse(err error) ProxyResponse {
+	res := ProxyResponse{}
+	res.Success = false
+	res.Code = FrpServerError
+	res.Message = err.Error()
+	var statusErr *frpsclient.StatusError
+	if errors.As(err, &statusErr) {
+		res.Code = statusErr.StatusCode
+	}
+	return res
+}
+
+// MigratePluginKeys 为没有插件密钥的服务器生成密钥, 需要在 AutoMigrate 建立唯一索引之前执行
+func MigratePluginKeys(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasTable(&model.ServerInfo{}) {
+		return nil
+	}
+	if !migrator.HasColumn(&model.ServerInfo{}, "PluginKey") {
+		if err := migrator.AddColumn(&model.ServerInfo{}, "PluginKey"); err != nil {
+			return err
+		}
+	}
+	// 旧版本的普通索引与唯一索引同列, 先删除
+	if migrator.HasIndex(&model.ServerInfo{}, "idx_server_infos_plugin_key") {
+		if err := migrator.DropIndex(&model.ServerInfo{}, "idx_server_infos_plugin_key"); err != nil {
+			return err
+		}
+	}
 
+	var servers []model.ServerInfo
+	if result := db.Where("plugin_key = '' OR plugin_key IS NULL").Find(&servers); result.Error != nil {
+		return result.Error
+	}
+	for _, server := range servers {
+		key, err := model.NewPluginKey()
 		if err != nil {
-			res.Success = false
-			res.Message = err.Error()
-		} else {
-			if res.Code == http.StatusOK {
-				res.Success = true
-				res.Data = string(body)
-				res.Message = fmt.Sprintf("Proxy to %s success", requestUrl)
-			} else {
-				res.Success = false
-				if res.Code == http.StatusNotFound {
-					res.Message = fmt.Sprintf("Proxy to %s error: url not found", requestUrl)
-				} else {
-					res.Message = fmt.Sprintf("Proxy to %s error: %s", requestUrl, string(body))
-				}
-			}
+			return err
+		}
+		if result := db.Model(&model.ServerInfo{}).Where("id = ?", server.ID).Update("plugin_key", key); result.Error != nil {
+			return result.Error
 		}
-		log.Printf(res.Message)
-		context.JSON(http.StatusOK, &res)
+		log.Printf("generated plugin key for server [%s], update its frps plugin path to /handler/<plugin key>", server.Name)
 	}
+	return nil
 }
@@ -0,0 +1,297 @@
+package controller
+
+import (
+	gocontext "context"
+	"fmt"
+	"frps-panel/pkg/frpsclient"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	plugin "github.com/fatedier/frp/pkg/plugin/server"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 超过该时间没有插件请求的会话视为已断开, frpc 默认每 30 秒发送一次 Ping
+	sessionIdleTimeout = 10 * time.Minute
+	// 被踢下线的会话在该时间内不能重新登录, 管理员可提前解除
+	kickedSessionTimeout = time.Hour
+	frpsActionTimeout    = 10 * time.Second
+)
+
+type sessionKey struct {
+	server string
+	user   string
+}
+
+type kickMark struct {
+	sessionKey
+	at time.Time
+}
+
+// sessionTracker 记录插件请求中出现的 frpc 会话 (run id).
+// 被踢下线的会话在 Ping、NewWorkConn、NewUserConn、NewProxy 时被拒绝, frps 收到 Ping 被拒绝后会关闭该客户端的连接.
+// frpc 重连时使用相同的 run id, 在标记过期或管理员解除之前登录也会被拒绝, 重新启动的 frpc 使用新的 run id
+type sessionTracker struct {
+	mu        sync.Mutex
+	seen      map[sessionKey]map[string]time.Time
+	kicked    map[string]kickMark
+	lastPrune time.Time
+}
+
+func newSessionTracker() *sessionTracker {
+	return &sessionTracker{
+		seen:      make(map[sessionKey]map[string]time.Time),
+		kicked:    make(map[string]kickMark),
+		lastPrune: time.Now(),
+	}
+}
+
+// touch 记录会话的最近一次请求
+func (t *sessionTracker) touch(server string, user string, runID string) {
+	if runID == "" {
+		return
+	}
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := sessionKey{server: server, user: user}
+	if t.seen[key] == nil {
+		t.seen[key] = make(map[string]time.Time)
+	}
+	t.seen[key][runID] = now
+	if now.Sub(t.lastPrune) > sessionIdleTimeout {
+		t.prune(now)
+	}
+}
+
+// login 记录登录成功的会话
+func (t *sessionTracker) login(server string, user string, runID string) {
+	t.touch(server, user, runID)
+}
+
+func (t *sessionTracker) isKicked(runID string) bool {
+	if runID == "" {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	mark, ok := t.kicked[runID]
+	return ok && time.Since(mark.at) <= kickedSessionTimeout
+}
+
+// Kick 将用户最近活跃的会话标记为踢下线, server 为空时包括所有服务器, 返回涉及的服务器
+func (t *sessionTracker) Kick(server string, user string) []string {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.prune(now)
+	var servers []string
+	for key, runIDs := range t.seen {
+		if key.user != user || (server != "" && key.server != server) {
+			continue
+		}
+		for runID := range runIDs {
+			t.kicked[runID] = kickMark{sessionKey: key, at: now}
+		}
+		servers = append(servers, key.server)
+	}
+	return servers
+}
+
+// Unkick 解除用户被踢下线的会话, server 为空时包括所有服务器, 返回解除的会话数
+func (t *sessionTracker) Unkick(server string, user string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	count := 0
+	for runID, mark := range t.kicked {
+		if mark.user != user || (server != "" && mark.server != server) {
+			continue
+		}
+		delete(t.kicked, runID)
+		count++
+	}
+	return count
+}
+
+func (t *sessionTracker) prune(now time.Time) {
+	for key, runIDs := range t.seen {
+		for runID, lastSeen := range runIDs {
+			if now.Sub(lastSeen) > sessionIdleTimeout {
+				delete(runIDs, runID)
+			}
+		}
+		if len(runIDs) == 0 {
+			delete(t.seen, key)
+		}
+	}
+	for runID, mark := range t.kicked {
+		if now.Sub(mark.at) > kickedSessionTimeout {
+			delete(t.kicked, runID)
+		}
+	}
+	t.lastPrune = now
+}
+
+// JudgeSession 记录会话, 并拒绝被管理员踢下线的会话
+func (c *HandleController) JudgeSession(user string, runID string, server *ServerInfo) plugin.Response {
+	var res plugin.Response
+	serverName := ""
+	if server != nil {
+		serverName = server.Name
+	}
+	c.sessions.touch(serverName, user, runID)
+	if runID != "" && c.sessions.isKicked(runID) {
+		res.Reject = true
+		res.RejectReason = fmt.Sprintf("session of user [%s] was closed by admin", user)
+		return res
+	}
+	res.Unchange = true
+	return res
+}
+
+// disconnectUser 踢下线用户在所有服务器上的会话, 不访问 frps.
+// frps 只能清理所有用户的离线代理, 不在这里自动清理, 返回提示告知管理员可在服务器页面手动清理
+func (c *HandleController) disconnectUser(user string) []string {
+	servers := c.sessions.Kick("", user)
+	if len(servers) == 0 {
+		return nil
+	}
+	log.Printf("closing sessions of user [%s] on servers %v", user, servers)
+	return []string{fmt.Sprintf("sessions of user [%s] on servers %v will be closed, its offline proxies stay on frps until an admin clears offline proxies of those servers, which removes offline proxies of all users", user, servers)}
+}
+
+// frpsClientOf 返回访问指定服务器 dashboard 的客户端
+func (c *HandleController) frpsClientOf(name string) (*frpsclient.Client, error) {
+	var server ServerInfo
+	if result := c.DB.Where("name = ?", name).Limit(1).Find(&server); result.Error != nil {
+		return nil, result.Error
+	} else if result.RowsAffected == 0 {
+		return nil, fmt.Errorf("server [%s] not found", name)
+	}
+	return c.frpsClients.Get(server)
+}
+
+// clearOfflineProxies 通过 frps 的 api 删除所有用户的离线代理, 先按 /api/serverinfo 的版本检查是否支持
+func (c *HandleController) clearOfflineProxies(ctx gocontext.Context, name string) error {
+	client, err := c.frpsClientOf(name)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := gocontext.WithTimeout(ctx, frpsActionTimeout)
+	defer cancel()
+	info, err := client.ServerInfo(ctx)
+	if err != nil {
+		return err
+	}
+	if !frpsclient.SupportsClearOfflineProxies(info.Version) {
+		return fmt.Errorf("frps %s does not support clearing offline proxies, v%s or later is required", info.Version, frpsclient.ClearOfflineProxiesVersion)
+	}
+	return client.ClearOfflineProxies(ctx)
+}
+
+// 踢下线用户的 frpc 会话
+func (c *HandleController) MakeKickUserFunc() func(context *gin.Context) {
+	return func(context *gin.Context) {
+		var req struct {
+			User   string `json:"user"`
+			Server string `json:"server"`
+		}
+		if err := context.BindJSON(&req); err != nil || trimString(req.User) == "" {
+			context.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Invalid request body",
+			})
+			return
+		}
+
+		servers := c.sessions.Kick(req.Server, req.User)
+		if len(servers) == 0 {
+			context.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("No active session of user [%s] found", req.User),
+			})
+			return
+		}
+		c.recordAudit(context, AuditUserKick, req.User, gin.H{"server": req.Server, "servers": servers})
+		context.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "User sessions will be closed on the next heartbeat",
+			"servers": servers,
+		})
+	}
+}
+
+// 解除用户被踢下线的会话, 允许 frpc 使用原来的会话重新登录
+func (c *HandleController) MakeUnkickUserFunc() func(context *gin.Context) {
+	return func(context *gin.Context) {
+		var req struct {
+			User   string `json:"user"`
+			Server string `json:"server"`
+		}
+		if err := context.BindJSON(&req); err != nil || trimString(req.User) == "" {
+			context.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Invalid request body",
+			})
+			return
+		}
+
+		count := c.sessions.Unkick(req.Server, req.User)
+		if count == 0 {
+			context.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("No kicked session of user [%s] found", req.User),
+			})
+			return
+		}
+		c.recordAudit(context, AuditUserUnkick, req.User, gin.H{"server": req.Server, "sessions": count})
+		context.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "User sessions can log in again",
+		})
+	}
+}
+
+// 清理服务器上的离线代理, 未指定服务器时使用当前服务器
+func (c *HandleController) MakeClearOfflineProxiesFunc() func(context *gin.Context) {
+	return func(context *gin.Context) {
+		var req struct {
+			Server string `json:"server"`
+		}
+		if err := context.BindJSON(&req); err != nil {
+			context.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Invalid request body",
+			})
+			return
+		}
+
+		if req.Server == "" {
+			var servers []ServerInfo
+			if result := c.DB.Find(&servers); result.Error != nil || c.CurrentDashboardIndex >= len(servers) {
+				context.JSON(http.StatusInternalServerError, gin.H{
+					"success": false,
+					"message": "No dashboard configured or invalid current index",
+				})
+				return
+			}
+			req.Server = servers[c.CurrentDashboardIndex].Name
+		}
+
+		if err := c.clearOfflineProxies(context.Request.Context(), req.Server); err != nil {
+			context.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		c.recordAudit(context, AuditProxiesClear, req.Server, gin.H{"server": req.Server})
+		context.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "Offline proxies cleared",
+		})
+	}
+}
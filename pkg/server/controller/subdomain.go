@@ -0,0 +1,313 @@
+package controller
+
+import (
+	"fmt"
+	"frps-panel/pkg/server/model"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// 未配置 subdomain_claim_limit 时每个用户可自助申请的子域名数
+const defaultSubdomainClaimLimit = 3
+
+// 未配置 reserved_subdomains 时使用的保留子域名
+var defaultReservedSubdomains = []string{
+	"www", "admin", "api", "mail", "smtp", "pop", "imap", "ftp", "ns1", "ns2", "dashboard", "panel",
+}
+
+// reservedSubdomains 返回保留的子域名列表
+func (c *HandleController) reservedSubdomains() []string {
+	if len(c.CommonInfo.ReservedSubdomains) > 0 {
+		return c.CommonInfo.ReservedSubdomains
+	}
+	return defaultReservedSubdomains
+}
+
+func (c *HandleController) isReservedSubdomain(subdomain string) bool {
+	for _, reserved := range c.reservedSubdomains() {
+		if strings.EqualFold(trimString(reserved), subdomain) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadSubdomainIndex 返回所有用户的子域名索引, 优先使用缓存
+func (c *HandleController) loadSubdomainIndex() *subdomainIndex {
+	if index, ok := c.userCache.Subdomains(); ok {
+		return index
+	}
+	generation := c.userCache.Generation()
+	index := &subdomainIndex{
+		owners: make(map[string][]subdomainOwner),
+		claims: make(map[subdomainOwner][]string),
+	}
+	add := func(subdomain string, owner subdomainOwner) {
+		subdomain = strings.ToLower(trimString(subdomain))
+		if subdomain != "" {
+			index.owners[subdomain] = append(index.owners[subdomain], owner)
+		}
+	}
+
+	var claims []model.SubdomainClaim
+	c.DB.Find(&claims)
+	for _, claim := range claims {
+		owner := subdomainOwner{User: claim.User, Server: claim.Server}
+		add(claim.Subdomain, owner)
+		index.claims[owner] = append(index.claims[owner], claim.Subdomain)
+	}
+
+	var userServers []model.UserServer
+	c.DB.Find(&userServers)
+	for _, userServer := range userServers {
+		allocation, err := ToServerAllocation(userServer)
+		if err != nil {
+			continue
+		}
+		for _, granted := range allocation.Subdomains {
+			add(granted, subdomainOwner{User: userServer.User, Server: userServer.Server})
+		}
+	}
+
+	var userTokens []model.UserToken
+	c.DB.Where("server = ''").Find(&userTokens)
+	for _, userToken := range userTokens {
+		info, err := ToUserTokenInfo(userToken)
+		if err != nil {
+			continue
+		}
+		for _, granted := range info.Subdomains {
+			add(granted, subdomainOwner{User: info.User})
+		}
+	}
+
+	c.userCache.SetSubdomains(index, generation)
+	return index
+}
+
+// findSubdomainOwner 查找在同一服务器上已拥有该子域名的其他用户, 未分配服务器的用户视为使用所有服务器
+func (c *HandleController) findSubdomainOwner(user string, server string, subdomain string) (string, bool) {
+	for _, owner := range c.loadSubdomainIndex().owners[strings.ToLower(trimString(subdomain))] {
+		if owner.User != user && (server == "" || owner.Server == "" || owner.Server == server) {
+			return owner.User, true
+		}
+	}
+	return "", false
+}
+
+// claimedSubdomains 返回用户在指定服务器上自助申请的子域名, 包括未分配服务器的用户对所有服务器申请的子域名
+func (c *HandleController) claimedSubdomains(user string, server string) []string {
+	index := c.loadSubdomainIndex()
+	claimed := index.claims[subdomainOwner{User: user, Server: server}]
+	if server != "" {
+		claimed = append(append([]string{}, claimed...), index.claims[subdomainOwner{User: user}]...)
+	}
+	return claimed
+}
+
+// subdomainClaimLimit 返回用户可自助申请的子域名数, 用户没有单独设置时使用配置
+func (c *HandleController) subdomainClaimLimit(info UserTokenInfo) int {
+	if info.SubdomainClaimLimit != nil {
+		return *info.SubdomainClaimLimit
+	}
+	switch limit := c.CommonInfo.SubdomainClaimLimit; {
+	case limit < 0:
+		return 0
+	case limit == 0:
+		return defaultSubdomainClaimLimit
+	default:
+		return limit
+	}
+}
+
+// 查询当前用户申请的子域名
+func (c *HandleController) MakeQuerySubdomainClaimsFunc() func(context *gin.Context) {
+	return func(context *gin.Context) {
+		session := sessions.Default(context)
+		currentUser := fmt.Sprintf("%v", session.Get("current_user"))
+
+		var claims []model.SubdomainClaim
+		if result := c.DB.Where("user = ?", currentUser).Order("id").Find(&claims); result.Error != nil {
+			context.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Failed to query subdomain claims"})
+			return
+		}
+
+		type claimInfo struct {
+			Server     string `json:"server"`
+			Subdomain  string `json:"subdomain"`
+			CreateDate string `json:"create_date"`
+		}
+		data := make([]claimInfo, 0, len(claims))
+		for _, claim := range claims {
+			data = append(data, claimInfo{
+				Server:     claim.Server,
+				Subdomain:  claim.Subdomain,
+				CreateDate: claim.CreatedAt.Format("2006-01-02 15:04:05"),
+			})
+		}
+
+		limit := 0
+		if info, err := c.queryUserTokenInfo(currentUser); err == nil {
+			limit = c.subdomainClaimLimit(info)
+		}
+		context.JSON(http.StatusOK, gin.H{
+			"code":  0,
+			"msg":   "success",
+			"count": len(data),
+			"data":  data,
+			"limit": limit,
+		})
+	}
+}
+
+// 普通用户自助申请子域名
+func (c *HandleController) MakeClaimSubdomainFunc() func(context *gin.Context) {
+	return func(context *gin.Context) {
+		var req struct {
+			Server    string `json:"server"`
+			Subdomain string `json:"subdomain"`
+		}
+		response := OperationResponse{
+			Success: true,
+			Code:    Success,
+			Message: "claim success",
+		}
+		if err := context.BindJSON(&req); err != nil {
+			response.Success = false
+			response.Code = ParamError
+			response.Message = fmt.Sprintf("claim failed, param error : %v", err)
+			context.JSON(http.StatusOK, &response)
+			return
+		}
+
+		session := sessions.Default(context)
+		currentUser := fmt.Sprintf("%v", session.Get("current_user"))
+		server := trimString(req.Server)
+		subdomain := strings.ToLower(trimString(req.Subdomain))
+
+		info, err := c.queryUserTokenInfo(currentUser)
+		if err != nil {
+			response.Success = false
+			response.Code = UserNotExist
+			response.Message = fmt.Sprintf("claim failed, user [%s] not exist", currentUser)
+			context.JSON(http.StatusOK, &response)
+			return
+		}
+		// 与 allocationFor 一致, 未分配服务器的用户可以使用所有服务器, 不指定服务器时申请的子域名对所有服务器有效
+		if server == "" {
+			if names := info.serverNames(); len(names) > 0 {
+				server = names[0]
+			}
+		}
+		var serverCount int64
+		if server != "" {
+			c.DB.Model(&ServerInfo{}).Where("name = ?", server).Count(&serverCount)
+		}
+		if _, ok := info.allocationFor(server); !ok || (server != "" && serverCount == 0) {
+			response.Success = false
+			response.Code = ServersFormatError
+			response.Message = fmt.Sprintf("claim failed, server [%s] is not available for user [%s]", server, currentUser)
+			context.JSON(http.StatusOK, &response)
+			return
+		}
+
+		if !subdomainFormat.MatchString(subdomain) {
+			response.Success = false
+			response.Code = SubdomainsFormatError
+			response.Message = fmt.Sprintf("claim failed, subdomain [%s] format error", subdomain)
+			context.JSON(http.StatusOK, &response)
+			return
+		}
+		if c.isReservedSubdomain(subdomain) {
+			response.Success = false
+			response.Code = SubdomainsReservedError
+			response.Message = fmt.Sprintf("claim failed, subdomain [%s] is reserved", subdomain)
+			context.JSON(http.StatusOK, &response)
+			return
+		}
+		if owner, taken := c.findSubdomainOwner(currentUser, server, subdomain); taken {
+			response.Success = false
+			response.Code = SubdomainsConflictError
+			response.Message = fmt.Sprintf("claim failed, subdomain [%s] is already owned by user [%s]", subdomain, owner)
+			context.JSON(http.StatusOK, &response)
+			return
+		}
+		if stringContains(subdomain, c.claimedSubdomains(currentUser, server)) {
+			context.JSON(http.StatusOK, &response)
+			return
+		}
+
+		var count int64
+		c.DB.Model(&model.SubdomainClaim{}).Where("user = ?", currentUser).Count(&count)
+		if limit := c.subdomainClaimLimit(info); int(count) >= limit {
+			response.Success = false
+			response.Code = SubdomainClaimLimitError
+			response.Message = fmt.Sprintf("claim failed, user [%s] has reached the limit of %d subdomains", currentUser, limit)
+			context.JSON(http.StatusOK, &response)
+			return
+		}
+
+		claim := model.SubdomainClaim{
+			User:      currentUser,
+			Server:    server,
+			Subdomain: subdomain,
+		}
+		result := c.DB.Create(&claim)
+		c.userCache.Invalidate(currentUser)
+		if result.Error != nil {
+			response.Success = false
+			response.Code = SaveError
+			response.Message = fmt.Sprintf("claim failed, db error : %v", result.Error)
+			log.Printf(response.Message)
+			context.JSON(http.StatusOK, &response)
+			return
+		}
+		log.Printf("user [%s] claimed subdomain [%s] on server [%s]", currentUser, subdomain, server)
+		context.JSON(http.StatusOK, &response)
+	}
+}
+
+// 普通用户释放自助申请的子域名
+func (c *HandleController) MakeReleaseSubdomainFunc() func(context *gin.Context) {
+	return func(context *gin.Context) {
+		var req struct {
+			Server    string `json:"server"`
+			Subdomain string `json:"subdomain"`
+		}
+		response := OperationResponse{
+			Success: true,
+			Code:    Success,
+			Message: "release success",
+		}
+		if err := context.BindJSON(&req); err != nil {
+			response.Success = false
+			response.Code = ParamError
+			response.Message = fmt.Sprintf("release failed, param error : %v", err)
+			context.JSON(http.StatusOK, &response)
+			return
+		}
+
+		session := sessions.Default(context)
+		currentUser := fmt.Sprintf("%v", session.Get("current_user"))
+		result := c.DB.Unscoped().
+			Where("user = ? AND server = ? AND subdomain = ?", currentUser, trimString(req.Server), strings.ToLower(trimString(req.Subdomain))).
+			Delete(&model.SubdomainClaim{})
+		c.userCache.Invalidate(currentUser)
+		if result.Error != nil {
+			response.Success = false
+			response.Code = SaveError
+			response.Message = fmt.Sprintf("release failed, db error : %v", result.Error)
+		} else if result.RowsAffected == 0 {
+			response.Success = false
+			response.Code = ParamError
+			response.Message = fmt.Sprintf("release failed, subdomain [%s] is not claimed by user [%s]", req.Subdomain, currentUser)
+		} else {
+			log.Printf("user [%s] released subdomain [%s] on server [%s]", currentUser, req.Subdomain, req.Server)
+		}
+		context.JSON(http.StatusOK, &response)
+	}
+}
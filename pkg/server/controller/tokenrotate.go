@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"frps-panel/pkg/server/model"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	rotatedTokenLength = 32
+	// 未配置 token_rotation_grace 时旧 token 最多保留的分钟数
+	defaultTokenRotationGrace = 60
+)
+
+// previousTokenValid 判断更换前的 token 是否仍在宽限期内
+func (info UserTokenInfo) previousTokenValid(token string, now time.Time) bool {
+	return info.PreviousToken != "" && info.PreviousToken == token && now.Unix() < info.PreviousTokenUntil
+}
+
+// maxTokenRotationGrace 返回旧 token 最多保留的分钟数, 0 表示不保留
+func (c *HandleController) maxTokenRotationGrace() int {
+	switch grace := c.CommonInfo.TokenRotationGrace; {
+	case grace < 0:
+		return 0
+	case grace == 0:
+		return defaultTokenRotationGrace
+	default:
+		return grace
+	}
+}
+
+// generateToken 生成满足 tokenFormat 的随机 token
+func generateToken() (string, error) {
+	token, err := randomString(rotatedTokenLength)
+	if err != nil {
+		return "", err
+	}
+	if !tokenFormat.MatchString(token) {
+		return "", errors.New("generated token does not match token format")
+	}
+	return token, nil
+}
+
+// 普通用户更换自己的 token, 旧 token 可在宽限期内继续用于 frpc, 返回使用新 token 的 toml 配置
+func (c *HandleController) MakeRotateTokenFunc() func(context *gin.Context) {
+	return func(context *gin.Context) {
+		var req struct {
+			GraceMinutes int `json:"grace_minutes"`
+		}
+		if err := context.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			context.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Invalid request body",
+			})
+			return
+		}
+		maxGrace := c.maxTokenRotationGrace()
+		if req.GraceMinutes < 0 || req.GraceMinutes > maxGrace {
+			context.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("grace_minutes must be between 0 and %d", maxGrace),
+			})
+			return
+		}
+
+		// 先生成并校验新配置, 失败时不更换 token
+		text, data, ok := c.frpcConfigRequest(context)
+		if !ok {
+			return
+		}
+		user := data.User
+		token, err := generateToken()
+		if err != nil {
+			context.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "Failed to generate token: " + err.Error(),
+			})
+			return
+		}
+		oldToken := data.Token
+		data.Token = token
+		config, ok := renderValidFrpcConfig(context, text, data, FrpcFormatToml)
+		if !ok {
+			return
+		}
+
+		var previousUntil int64
+		previousToken := ""
+		if req.GraceMinutes > 0 {
+			previousToken = oldToken
+			previousUntil = time.Now().Add(time.Duration(req.GraceMinutes) * time.Minute).Unix()
+		}
+		// 只在 token 未被同时修改时更换
+		result := c.DB.Model(&model.UserToken{}).Where("user = ? AND token = ?", user, oldToken).Updates(map[string]interface{}{
+			"token":                token,
+			"previous_token":       previousToken,
+			"previous_token_until": previousUntil,
+		})
+		c.userCache.Invalidate(user)
+		if result.Error != nil {
+			context.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "Failed to save token: " + result.Error.Error(),
+			})
+			return
+		}
+		if result.RowsAffected == 0 {
+			context.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"message": "token was changed by another request, please reload",
+			})
+			return
+		}
+
+		// token 同时是面板登录密码, 更新会话中的凭证
+		session := sessions.Default(context)
+		if session.Get(UserRoleName) == UserRoleNormal {
+			session.Set(AuthName, encodeBasicAuth(user, token))
+			_ = session.Save()
+		}
+
+		log.Printf("user [%s] rotated token, previous token valid for %d minutes", user, req.GraceMinutes)
+		c.recordAudit(context, AuditTokenRotate, user, gin.H{"grace_minutes": req.GraceMinutes})
+		context.JSON(http.StatusOK, gin.H{
+			"success":              true,
+			"message":              "token rotated",
+			"token":                token,
+			"previous_token_until": previousUntil,
+			"server":               data.Server,
+			"config":               string(config),
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package controller
+
+import (
+	gocontext "context"
+	"errors"
+	"fmt"
+	"frps-panel/pkg/frpsclient"
+	"frps-panel/pkg/server/model"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultTrafficCollectInterval = time.Minute
+	trafficDayFormat              = "2006-01-02"
+)
+
+// frps 的代理类型, 采集时逐个查询
+var trafficProxyTypes = []string{"tcp", "udp", "http", "https", "stcp", "sudp", "xtcp", "tcpmux"}
+
+// trafficCollector 定时从各 frps 的 dashboard 采集代理流量, 按天累加每次采集的增量
+type trafficCollector struct {
+	db       *gorm.DB
+	clients  *serverClients
+	interval time.Duration
+	cache    *userCache
+}
+
+// newTrafficCollector 根据配置的秒数启动采集, 0 使用默认值, 负数表示不采集
+func newTrafficCollector(db *gorm.DB, clients *serverClients, intervalSeconds int, cache *userCache) *trafficCollector {
+	if db == nil || intervalSeconds < 0 {
+		return nil
+	}
+	t := &trafficCollector{db: db, clients: clients, interval: defaultTrafficCollectInterval, cache: cache}
+	if intervalSeconds > 0 {
+		t.interval = time.Duration(intervalSeconds) * time.Second
+	}
+	go t.run()
+	return t
+}
+
+func (t *trafficCollector) run() {
+	for {
+		t.collect()
+		time.Sleep(t.interval)
+	}
+}
+
+func (t *trafficCollector) collect() {
+	var servers []ServerInfo
+	if result := t.db.Find(&servers); result.Error != nil {
+		log.Printf("failed to query servers for traffic collection: %v", result.Error)
+		return
+	}
+	for _, server := range servers {
+		client, err := t.clients.Get(server)
+		if err != nil {
+			log.Printf("failed to collect traffic of server [%s]: %v", server.Name, err)
+			continue
+		}
+		for _, proxyType := range trafficProxyTypes {
+			proxies, err := client.Proxies(gocontext.Background(), proxyType)
+			if err != nil {
+				log.Printf("failed to collect %s traffic of server [%s]: %v", proxyType, server.Name, err)
+				// 服务器不可达时跳过其余类型
+				break
+			}
+			for _, proxy := range proxies {
+				if err := t.record(server.Name, proxyType, proxy); err != nil {
+					log.Printf("failed to save traffic of proxy [%s] on server [%s]: %v", proxy.Name, server.Name, err)
+				}
+			}
+		}
+	}
+	t.updateQuotaUsage()
+}
+
+// record 计算与上次采集相比的增量并累加到当天的记录中
+// frps 的今日流量在重启或跨天时归零, 计数变小时将当前值作为增量
+func (t *trafficCollector) record(server string, proxyType string, proxy frpsclient.ProxyStats) error {
+	return t.db.Transaction(func(tx *gorm.DB) error {
+		var cursor model.ProxyTrafficCursor
+		result := tx.Where("server = ? AND proxy_name = ?", server, proxy.Name).First(&cursor)
+		if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return result.Error
+		}
+
+		deltaIn, deltaOut := proxy.TodayTrafficIn, proxy.TodayTrafficOut
+		if result.Error == nil && proxy.TodayTrafficIn >= cursor.TrafficIn && proxy.TodayTrafficOut >= cursor.TrafficOut {
+			deltaIn, deltaOut = proxy.TodayTrafficIn-cursor.TrafficIn, proxy.TodayTrafficOut-cursor.TrafficOut
+		}
+
+		cursor.Server, cursor.ProxyName = server, proxy.Name
+		cursor.TrafficIn, cursor.TrafficOut = proxy.TodayTrafficIn, proxy.TodayTrafficOut
+		if err := tx.Save(&cursor).Error; err != nil {
+			return err
+		}
+		if deltaIn == 0 && deltaOut == 0 {
+			return nil
+		}
+
+		daily := model.TrafficDaily{
+			Server:     server,
+			ProxyName:  proxy.Name,
+			Day:        time.Now().Format(trafficDayFormat),
+			User:       proxyOwner(proxy.Name, proxy.User),
+			ProxyType:  proxyType,
+			TrafficIn:  deltaIn,
+			TrafficOut: deltaOut,
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "server"}, {Name: "proxy_name"}, {Name: "day"}},
+			DoUpdates: clause.Assignments(map[string]any{
+				"traffic_in":  gorm.Expr("traffic_in + ?", deltaIn),
+				"traffic_out": gorm.Expr("traffic_out + ?", deltaOut),
+				"updated_at":  time.Now(),
+			}),
+		}).Create(&daily).Error
+	})
+}
+
+type TrafficStat struct {
+	Period     string `json:"period"`
+	TrafficIn  int64  `json:"traffic_in"`
+	TrafficOut int64  `json:"traffic_out"`
+}
+
+// requestUser 普通用户只能查询自己的数据, 管理员通过 user 参数指定用户
+func requestUser(context *gin.Context) string {
+	session := sessions.Default(context)
+	if session.Get(UserRoleName) == UserRoleNormal {
+		return fmt.Sprintf("%v", session.Get("current_user"))
+	}
+	return trimString(context.Query("user"))
+}
+
+// queryTraffic 按 period 分组汇总用户的流量, period 为按天或按月截取的日期
+func (c *HandleController) queryTraffic(context *gin.Context, period string, since string) {
+	user := requestUser(context)
+	if user == "" {
+		context.JSON(http.StatusOK, gin.H{
+			"code":  ParamError,
+			"msg":   "user is required",
+			"count": 0,
+			"data":  []TrafficStat{},
+		})
+		return
+	}
+
+	query := c.DB.Model(&model.TrafficDaily{}).
+		Select(period+" AS period, SUM(traffic_in) AS traffic_in, SUM(traffic_out) AS traffic_out").
+		Where("user = ? AND day >= ?", user, since)
+	if server := trimString(context.Query("server")); server != "" {
+		query = query.Where("server = ?", server)
+	}
+
+	stats := make([]TrafficStat, 0)
+	if result := query.Group("period").Order("period").Scan(&stats); result.Error != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{
+			"code": SaveError,
+			"msg":  "Failed to query traffic: " + result.Error.Error(),
+		})
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{
+		"code":  0,
+		"msg":   "query traffic success",
+		"count": len(stats),
+		"data":  stats,
+	})
+}
+
+// 查询用户每天的流量, days 默认 30 天
+func (c *HandleController) MakeQueryDailyTrafficFunc() func(context *gin.Context) {
+	return func(context *gin.Context) {
+		days, _ := strconv.Atoi(context.DefaultQuery("days", "30"))
+		if days < 1 || days > 366 {
+			days = 30
+		}
+		since := time.Now().AddDate(0, 0, 1-days).Format(trafficDayFormat)
+		c.queryTraffic(context, "day", since)
+	}
+}
+
+// 查询用户每月的流量, months 默认 12 个月
+func (c *HandleController) MakeQueryMonthlyTrafficFunc() func(context *gin.Context) {
+	return func(context *gin.Context) {
+		months, _ := strconv.Atoi(context.DefaultQuery("months", "12"))
+		if months < 1 || months > 120 {
+			months = 12
+		}
+		now := time.Now()
+		firstDay := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		since := firstDay.AddDate(0, 1-months, 0).Format(trafficDayFormat)
+		c.queryTraffic(context, "SUBSTRING(day, 1, 7)", since)
+	}
+}
@@ -1,20 +1,18 @@
 package controller
 
 import (
-	"crypto/tls"
-	"encoding/json"
 	"fmt"
+	"frps-panel/pkg/frpsclient"
 	"frps-panel/pkg/server/model"
-	"io"
 	"log"
 	"net/http"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // 查询用户列表
@@ -45,6 +43,9 @@ func (c *HandleController) MakeQueryUserInfoFunc() func(context *gin.Context) {
 		}
 
 		tokenInfo, err := ToUserTokenInfo(userToken)
+		if err == nil {
+			err = c.loadAllocations(&tokenInfo)
+		}
 		if err != nil {
 			context.JSON(http.StatusInternalServerError, &TokenResponse{
 				Code:  SaveError,
@@ -80,19 +81,40 @@ func (c *HandleController) MakeQueryUserProxiesFunc() func(context *gin.Context)
 			return
 		}
 
-		// 调用 MakeProxyFunc 的核心逻辑来获取所有代理信息
-		// 这里需要模拟 MakeProxyFunc 的行为，或者重构 MakeProxyFunc 使其可复用
-		// 为了简化，我们直接在这里实现代理查询和过滤逻辑
-		var client *http.Client
-		var protocol string
+		info, err := c.queryUserTokenInfo(currentUser)
+		if err != nil {
+			context.JSON(http.StatusNotFound, gin.H{"success": false, "message": "User info not found"})
+			return
+		}
+
+		// 默认查询用户分配的第一个服务器, 只能查询分配给自己的服务器
+		serverName := context.Query("server")
+		if serverName == "" && len(info.Servers) > 0 {
+			serverName = info.Servers[0].Server
+		}
+		if _, ok := info.allocationFor(serverName); !ok {
+			context.JSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("Server [%s] is not assigned to user", serverName),
+			})
+			return
+		}
 
 		var servers []ServerInfo
-		if result := c.DB.Find(&servers); result.Error != nil {
+		query := c.DB
+		if serverName != "" {
+			query = query.Where("name = ?", serverName)
+		}
+		if result := query.Find(&servers); result.Error != nil {
 			context.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Failed to query servers"})
 			return
 		}
 
-		if c.CurrentDashboardIndex >= len(servers) {
+		currentIndex := 0
+		if serverName == "" {
+			currentIndex = c.CurrentDashboardIndex
+		}
+		if currentIndex >= len(servers) {
 			context.JSON(http.StatusInternalServerError, gin.H{
 				"success": false,
 				"message": "No dashboard configured or invalid current index",
@@ -100,124 +122,53 @@ func (c *HandleController) MakeQueryUserProxiesFunc() func(context *gin.Context)
 			return
 		}
 
-		currentDashboard := servers[c.CurrentDashboardIndex]
-
-		if currentDashboard.DashboardTls {
-			client = &http.Client{
-				Transport: &http.Transport{
-					TLSClientConfig: &tls.Config{
-						InsecureSkipVerify: true,
-					},
-				},
-			}
-			protocol = "https://"
-		} else {
-			client = http.DefaultClient
-			protocol = "http://"
-		}
-
-		res := ProxyResponse{}
-		host := currentDashboard.DashboardAddr
-		port := currentDashboard.DashboardPort
-
-		host, _ = strings.CutPrefix(host, protocol)
+		currentDashboard := servers[currentIndex]
 
 		// 从查询参数中获取 proxyType，如果未提供则默认为 "http"
 		proxyType := context.DefaultQuery("proxyType", "http")
-		// 构建请求 frps 的代理列表 API
-		requestUrl := protocol + host + ":" + strconv.Itoa(port) + "/api/proxy/" + proxyType
-		request, _ := http.NewRequest("GET", requestUrl, nil)
-		username := currentDashboard.DashboardUser
-		password := currentDashboard.DashboardPwd
-		if trimString(username) != "" && trimString(password) != "" {
-			request.SetBasicAuth(username, password)
-			log.Printf("Proxy to %s", requestUrl)
+		client, err := c.frpsClients.Get(currentDashboard)
+		var proxies []frpsclient.ProxyStats
+		if err == nil {
+			proxies, err = client.Proxies(context.Request.Context(), proxyType)
 		}
-
-		response, err := client.Do(request)
-
 		if err != nil {
-			res.Code = FrpServerError
-			res.Success = false
-			res.Message = err.Error()
-			log.Print(err)
+			res := proxyErrorResponse(err)
+			log.Print(res.Message)
 			context.JSON(http.StatusOK, &res)
 			return
 		}
 
-		res.Code = response.StatusCode
-		body, err := io.ReadAll(response.Body)
-
-		if err != nil {
-			res.Success = false
-			res.Message = err.Error()
-		} else {
-			if res.Code == http.StatusOK {
-				var frpsProxies struct {
-					Proxies []struct {
-						Name          string `json:"name"`
-						Type          string `json:"type"`
-						Status        string `json:"status"`
-						Connections   int    `json:"curConns"`
-						TrafficIn     int64  `json:"todayTrafficIn"`
-						TrafficOut    int64  `json:"todayTrafficOut"`
-						ClientVersion string `json:"clientVersion"`
-						LastStart     string `json:"lastStartTime"`
-						LastClose     string `json:"lastCloseTime"`
-						Conf          struct {
-							RemotePort int `json:"remotePort"`
-							Transport  struct {
-								UseEncryption  bool `json:"useEncryption"`
-								UseCompression bool `json:"useCompression"`
-							} `json:"transport"`
-						} `json:"conf"`
-					} `json:"proxies"`
-				}
-				if err := json.Unmarshal(body, &frpsProxies); err != nil {
-					res.Success = false
-					res.Message = fmt.Sprintf("Failed to parse frps proxy response: %v", err)
-					context.JSON(http.StatusOK, &res)
-					return
-				}
-
-				var userProxies []gin.H
-				for _, proxy := range frpsProxies.Proxies {
-					if strings.HasPrefix(proxy.Name, currentUser) {
-						userProxies = append(userProxies, gin.H{
-							"Name":           proxy.Name,
-							"Type":           proxy.Type,
-							"Status":         proxy.Status,
-							"Connections":    proxy.Connections,
-							"TrafficIn":      proxy.TrafficIn,
-							"TrafficOut":     proxy.TrafficOut,
-							"ClientVersion":  proxy.ClientVersion,
-							"LastStart":      proxy.LastStart,
-							"LastClose":      proxy.LastClose,
-							"RemotePort":     proxy.Conf.RemotePort,
-							"UseEncryption":  proxy.Conf.Transport.UseEncryption,
-							"UseCompression": proxy.Conf.Transport.UseCompression,
-						})
-					}
-				}
-
-				context.JSON(http.StatusOK, gin.H{
-					"code":  0,
-					"msg":   "query user proxies success",
-					"count": len(userProxies),
-					"data":  userProxies,
-				})
-				return
-			} else {
-				res.Success = false
-				if res.Code == http.StatusNotFound {
-					res.Message = fmt.Sprintf("Proxy to %s error: url not found", requestUrl)
-				} else {
-					res.Message = fmt.Sprintf("Proxy to %s error: %s", requestUrl, string(body))
-				}
+		var userProxies []gin.H
+		for _, proxy := range proxies {
+			if !proxyOwnedBy(proxy.Name, proxy.User, currentUser) {
+				continue
+			}
+			item := gin.H{
+				"Name":          proxy.Name,
+				"Type":          proxy.Type,
+				"Status":        proxy.Status,
+				"Connections":   proxy.CurConns,
+				"TrafficIn":     proxy.TodayTrafficIn,
+				"TrafficOut":    proxy.TodayTrafficOut,
+				"ClientVersion": proxy.ClientVersion,
+				"LastStart":     proxy.LastStartTime,
+				"LastClose":     proxy.LastCloseTime,
 			}
+			// 离线代理没有 conf
+			if proxy.Conf != nil {
+				item["RemotePort"] = proxy.Conf.RemotePort
+				item["UseEncryption"] = proxy.Conf.Transport.UseEncryption
+				item["UseCompression"] = proxy.Conf.Transport.UseCompression
+			}
+			userProxies = append(userProxies, item)
 		}
-		log.Printf(res.Message)
-		context.JSON(http.StatusOK, &res)
+
+		context.JSON(http.StatusOK, gin.H{
+			"code":  0,
+			"msg":   "query user proxies success",
+			"count": len(userProxies),
+			"data":  userProxies,
+		})
 	}
 }
 
@@ -244,7 +195,8 @@ func (c *HandleController) MakeQueryTokensFunc() func(context *gin.Context) {
 		}
 
 		if search.Server != "" {
-			query = query.Where("server = ?", search.Server)
+			assigned := c.DB.Model(&model.UserServer{}).Select("user").Where("server = ?", search.Server)
+			query = query.Where("server = ? OR user IN (?)", search.Server, assigned)
 		}
 		if search.User != "" {
 			query = query.Where("user LIKE ?", "%"+search.User+"%")
@@ -258,6 +210,9 @@ func (c *HandleController) MakeQueryTokensFunc() func(context *gin.Context) {
 		var tokenList []UserTokenInfo
 		for _, ut := range userTokens {
 			info, err := ToUserTokenInfo(ut)
+			if err == nil {
+				err = c.loadAllocations(&info)
+			}
 			if err != nil {
 				log.Printf("Failed to convert user token: %v", err)
 				continue
@@ -332,6 +287,12 @@ func (c *HandleController) MakeAddTokenFunc() func(context *gin.Context) {
 		info.Subdomains = cleanStrings(info.Subdomains)
 		info.Server = cleanString(info.Server)         // 清理服务器名称
 		info.ExpireDate = cleanString(info.ExpireDate) // 清理到期时间
+		info.BandwidthUpload = cleanString(info.BandwidthUpload)
+		info.BandwidthDownload = cleanString(info.BandwidthDownload)
+		info.Quota = cleanString(info.Quota)
+		info.QuotaUsed, info.QuotaTopUp, info.QuotaCycle = 0, 0, ""
+		info.PreviousToken, info.PreviousTokenUntil = "", 0
+		normalizeAllocations(&info)
 
 		// Save to database or file
 		if c.DB != nil {
@@ -344,17 +305,24 @@ func (c *HandleController) MakeAddTokenFunc() func(context *gin.Context) {
 				context.JSON(http.StatusOK, &response)
 				return
 			}
-			result := c.DB.Create(&userToken)
-			if result.Error != nil {
+			err = c.DB.Transaction(func(tx *gorm.DB) error {
+				if result := tx.Create(&userToken); result.Error != nil {
+					return result.Error
+				}
+				return saveAllocations(tx, info)
+			})
+			c.userCache.Invalidate(info.User)
+			if err != nil {
 				response.Success = false
 				response.Code = SaveError
-				response.Message = fmt.Sprintf("user add failed, db error : %v", result.Error)
+				response.Message = fmt.Sprintf("user add failed, db error : %v", err)
 				log.Printf(response.Message)
 				context.JSON(http.StatusOK, &response)
 				return
 			}
 		}
 
+		c.recordAudit(context, AuditUserAdd, info.User, auditUserTokenInfo(info))
 		context.JSON(0, &response)
 	}
 }
@@ -390,6 +358,7 @@ func (c *HandleController) MakeUpdateTokensFunc() func(context *gin.Context) {
 			return
 		}
 
+		syncPrimaryAllocation(before, &after)
 		result := c.verifyToken(after, TOKEN_UPDATE)
 
 		if !result.Success {
@@ -404,6 +373,11 @@ func (c *HandleController) MakeUpdateTokensFunc() func(context *gin.Context) {
 		after.Server = cleanString(after.Server)         // 清理服务器名称
 		after.ExpireDate = cleanString(after.ExpireDate) // 清理到期时间
 		after.CreateDate = before.CreateDate             // 创建日期不应改变
+		after.BandwidthUpload = cleanString(after.BandwidthUpload)
+		after.BandwidthDownload = cleanString(after.BandwidthDownload)
+		after.Quota = cleanString(after.Quota)
+		after.QuotaUsed, after.QuotaTopUp, after.QuotaCycle = before.QuotaUsed, before.QuotaTopUp, before.QuotaCycle
+		normalizeAllocations(&after)
 
 		// Save to database or file
 		if c.DB != nil {
@@ -423,21 +397,53 @@ func (c *HandleController) MakeUpdateTokensFunc() func(context *gin.Context) {
 				"ports":       userToken.Ports,
 				"domains":     userToken.Domains,
 				"subdomains":  userToken.Subdomains,
+				"schedule":    userToken.Schedule,
+				"policy":      userToken.Policy,
 				"enable":      userToken.Enable,
 				"server":      userToken.Server,
 				"expire_date": userToken.ExpireDate,
 			}
-			result := c.DB.Model(&model.UserToken{}).Where("user = ?", userToken.User).Updates(updateData)
-			if result.Error != nil {
+			updateData["bandwidth_upload"] = userToken.BandwidthUpload
+			updateData["bandwidth_download"] = userToken.BandwidthDownload
+			updateData["quota"] = userToken.Quota
+			updateData["quota_reset_day"] = userToken.QuotaResetDay
+			updateData["subdomain_claim_limit"] = userToken.SubdomainClaimLimit
+			err = c.DB.Transaction(func(tx *gorm.DB) error {
+				// 请求中的 before 可能已过期, 按数据库中的用户比较 token 和记录审计
+				current, found, err := loadStoredUserTokenInfo(tx, userToken.User)
+				if err != nil {
+					return err
+				} else if !found {
+					return fmt.Errorf("user [%s] not exist", userToken.User)
+				}
+				before = current
+				// 面板维护的字段不会被修改
+				after.CreateDate = current.CreateDate
+				after.QuotaUsed, after.QuotaTopUp, after.QuotaCycle = current.QuotaUsed, current.QuotaTopUp, current.QuotaCycle
+				after.PreviousTokenUntil = current.PreviousTokenUntil
+				// 在自助更换之外修改 token 时, 宽限期内的旧 token 立即失效
+				if current.Token != userToken.Token {
+					updateData["previous_token"] = ""
+					updateData["previous_token_until"] = 0
+					after.PreviousTokenUntil = 0
+				}
+				if result := tx.Model(&model.UserToken{}).Where("user = ?", userToken.User).Updates(updateData); result.Error != nil {
+					return result.Error
+				}
+				return saveAllocations(tx, after)
+			})
+			c.userCache.Invalidate(after.User)
+			if err != nil {
 				response.Success = false
 				response.Code = SaveError
-				response.Message = fmt.Sprintf("user update failed, db error : %v", result.Error)
+				response.Message = fmt.Sprintf("user update failed, db error : %v", err)
 				log.Printf(response.Message)
 				context.JSON(http.StatusOK, &response)
 				return
 			}
 		}
 
+		c.recordAudit(context, AuditUserUpdate, after.User, diffUserTokenInfo(before, after))
 		context.JSON(http.StatusOK, &response)
 	}
 }
@@ -469,13 +475,34 @@ func (c *HandleController) MakeRemoveTokensFunc() func(context *gin.Context) {
 			}
 		}
 
+		// 审计记录删除前数据库中的用户, 而不是请求内容
+		removed := make(map[string]UserTokenInfo)
 		for _, user := range remove.Users {
 			if c.DB != nil {
-				result := c.DB.Delete(&model.UserToken{}, "user = ?", user.User)
-				if result.Error != nil {
+				err := c.DB.Transaction(func(tx *gorm.DB) error {
+					stored, found, err := loadStoredUserTokenInfo(tx, user.User)
+					if err != nil {
+						return err
+					} else if found {
+						removed[user.User] = stored
+					}
+					if result := tx.Delete(&model.UserToken{}, "user = ?", user.User); result.Error != nil {
+						return result.Error
+					}
+					if result := tx.Unscoped().Delete(&model.UserServer{}, "user = ?", user.User); result.Error != nil {
+						return result.Error
+					}
+					// 自助申请的子域名随用户删除, 否则其他用户无法再申请
+					return tx.Unscoped().Delete(&model.SubdomainClaim{}, "user = ?", user.User).Error
+				})
+				c.userCache.Invalidate(user.User)
+				if err == nil {
+					response.Warnings = append(response.Warnings, c.disconnectUser(user.User)...)
+				}
+				if err != nil {
 					response.Success = false
 					response.Code = SaveError
-					response.Message = fmt.Sprintf("user remove failed for %s, db error : %v", user.User, result.Error)
+					response.Message = fmt.Sprintf("user remove failed for %s, db error : %v", user.User, err)
 					log.Printf(response.Message)
 					context.JSON(http.StatusOK, &response)
 					return
@@ -486,6 +513,12 @@ func (c *HandleController) MakeRemoveTokensFunc() func(context *gin.Context) {
 		if c.DB == nil {
 		}
 
+		for _, user := range remove.Users {
+			if stored, ok := removed[user.User]; ok {
+				c.recordAudit(context, AuditUserRemove, user.User, auditUserTokenInfo(stored))
+			}
+		}
+
 		context.JSON(http.StatusOK, &response)
 	}
 }
@@ -517,9 +550,15 @@ func (c *HandleController) MakeDisableTokensFunc() func(context *gin.Context) {
 			}
 		}
 
+		// 审计记录数据库中修改前的状态
+		changed := make(map[string]bool)
 		for _, user := range disable.Users {
 			if c.DB != nil {
-				result := c.DB.Model(&model.UserToken{}).Where("user = ?", user.User).Update("enable", false)
+				result := c.setUserEnable(user.User, false, changed)
+				c.userCache.Invalidate(user.User)
+				if result.Error == nil {
+					response.Warnings = append(response.Warnings, c.disconnectUser(user.User)...)
+				}
 				if result.Error != nil {
 					response.Success = false
 					response.Code = SaveError
@@ -534,6 +573,12 @@ func (c *HandleController) MakeDisableTokensFunc() func(context *gin.Context) {
 		if c.DB == nil {
 		}
 
+		for _, user := range disable.Users {
+			if before, ok := changed[user.User]; ok {
+				c.recordAudit(context, AuditUserDisable, user.User, gin.H{"enable": gin.H{"before": before, "after": false}})
+			}
+		}
+
 		context.JSON(http.StatusOK, &response)
 	}
 }
@@ -565,9 +610,12 @@ func (c *HandleController) MakeEnableTokensFunc() func(context *gin.Context) {
 			}
 		}
 
+		// 审计记录数据库中修改前的状态
+		changed := make(map[string]bool)
 		for _, user := range enable.Users {
 			if c.DB != nil {
-				result := c.DB.Model(&model.UserToken{}).Where("user = ?", user.User).Update("enable", true)
+				result := c.setUserEnable(user.User, true, changed)
+				c.userCache.Invalidate(user.User)
 				if result.Error != nil {
 					response.Success = false
 					response.Code = SaveError
@@ -582,6 +630,32 @@ func (c *HandleController) MakeEnableTokensFunc() func(context *gin.Context) {
 		if c.DB == nil {
 		}
 
+		for _, user := range enable.Users {
+			if before, ok := changed[user.User]; ok {
+				c.recordAudit(context, AuditUserEnable, user.User, gin.H{"enable": gin.H{"before": before, "after": true}})
+			}
+		}
+
 		context.JSON(http.StatusOK, &response)
 	}
 }
+
+// setUserEnable 在事务中修改用户的启用状态, 并把修改前的状态记录到 before 中, 不存在的用户不记录
+func (c *HandleController) setUserEnable(user string, enable bool, before map[string]bool) *gorm.DB {
+	var result *gorm.DB
+	err := c.DB.Transaction(func(tx *gorm.DB) error {
+		var userTokens []model.UserToken
+		if result = tx.Select("enable").Where("user = ?", user).Limit(1).Find(&userTokens); result.Error != nil {
+			return result.Error
+		}
+		if len(userTokens) > 0 {
+			before[user] = userTokens[0].Enable
+		}
+		result = tx.Model(&model.UserToken{}).Where("user = ?", user).Update("enable", enable)
+		return result.Error
+	})
+	if err != nil && result.Error == nil {
+		result.Error = err
+	}
+	return result
+}
@@ -1,9 +1,11 @@
 package controller
 
 import (
+	"crypto/rand"
 	"fmt"
 	"frps-panel/pkg/server/model"
 	"log"
+	"math/big"
 	"strings"
 )
 
@@ -52,6 +54,9 @@ func (c *HandleController) verifyToken(token UserTokenInfo, operate int) Operati
 		validateDomains    = false
 		validateSubdomains = false
 		validateExpireDate = false // 新增验证到期时间
+		validateSchedule   = false
+		validatePolicy     = false
+		validateServers    = false
 	)
 
 	if operate == TOKEN_ADD {
@@ -63,6 +68,9 @@ func (c *HandleController) verifyToken(token UserTokenInfo, operate int) Operati
 		validateDomains = true
 		validateSubdomains = true
 		validateExpireDate = true // 新增验证到期时间
+		validateSchedule = true
+		validatePolicy = true
+		validateServers = true
 	} else if operate == TOKEN_UPDATE {
 		validateNotExist = true
 		validateUser = true
@@ -72,6 +80,9 @@ func (c *HandleController) verifyToken(token UserTokenInfo, operate int) Operati
 		validateDomains = true
 		validateSubdomains = true
 		validateExpireDate = true // 新增验证到期时间
+		validateSchedule = true
+		validatePolicy = true
+		validateServers = true
 	} else if operate == TOKEN_ENABLE || operate == TOKEN_DISABLE || operate == TOKEN_REMOVE {
 		validateNotExist = true
 	}
@@ -125,14 +136,38 @@ func (c *HandleController) verifyToken(token UserTokenInfo, operate int) Operati
 		return response
 	}
 
+	// 顶层限制与每个服务器的分配使用相同的格式校验
+	allocations := append([]ServerAllocation{{
+		Ports:      token.Ports,
+		Domains:    token.Domains,
+		Subdomains: token.Subdomains,
+	}}, token.Servers...)
+
 	if validatePorts {
-		for _, port := range token.Ports {
-			if str, ok := port.(string); ok {
-				trimmedPort := trimString(str)
-				if trimmedPort != "" && !portsFormatSingle.MatchString(trimmedPort) && !portsFormatRange.MatchString(trimmedPort) {
+		for _, allocation := range allocations {
+			for _, port := range allocation.Ports {
+				if str, ok := port.(string); ok {
+					trimmedPort := trimString(str)
+					if trimmedPort != "" && !portsFormatSingle.MatchString(trimmedPort) && !portsFormatRange.MatchString(trimmedPort) {
+						response.Success = false
+						response.Code = PortsFormatError
+						response.Message = fmt.Sprintf("operate failed, ports [%v] format error", allocation.Ports)
+						log.Printf(response.Message)
+						return response
+					}
+				}
+			}
+		}
+	}
+
+	if validateDomains {
+		for _, allocation := range allocations {
+			for _, domain := range allocation.Domains {
+				trimmedDomain := trimString(domain)
+				if trimmedDomain != "" && !validDomainRule(trimmedDomain) {
 					response.Success = false
-					response.Code = PortsFormatError
-					response.Message = fmt.Sprintf("operate failed, ports [%v] format error", token.Ports)
+					response.Code = DomainsFormatError
+					response.Message = fmt.Sprintf("operate failed, domains [%v] format error", allocation.Domains)
 					log.Printf(response.Message)
 					return response
 				}
@@ -141,28 +176,75 @@ func (c *HandleController) verifyToken(token UserTokenInfo, operate int) Operati
 	}
 
 	if validateDomains {
-		for _, domain := range token.Domains {
-			trimmedDomain := trimString(domain)
-			if trimmedDomain != "" && !domainFormat.MatchString(trimmedDomain) {
-				response.Success = false
-				response.Code = DomainsFormatError
-				response.Message = fmt.Sprintf("operate failed, domains [%v] format error", token.Domains)
-				log.Printf(response.Message)
-				return response
+		granted := token.Servers
+		if len(granted) == 0 {
+			granted = []ServerAllocation{{Server: trimString(token.Server), Domains: token.Domains}}
+		}
+		if rule, other, conflict := c.findDomainConflict(token.User, granted); conflict {
+			response.Success = false
+			response.Code = DomainsConflictError
+			response.Message = fmt.Sprintf("operate failed, domain [%s] overlaps with user [%s]", rule, other)
+			log.Printf(response.Message)
+			return response
+		}
+	}
+
+	if validateSubdomains {
+		for _, allocation := range allocations {
+			for _, subdomain := range allocation.Subdomains {
+				trimmedSubdomain := trimString(subdomain)
+				if trimmedSubdomain != "" && !subdomainFormat.MatchString(trimmedSubdomain) {
+					response.Success = false
+					response.Code = SubdomainsFormatError
+					response.Message = fmt.Sprintf("operate failed, subdomains [%v] format error", allocation.Subdomains)
+					log.Printf(response.Message)
+					return response
+				}
 			}
 		}
 	}
 
 	if validateSubdomains {
-		for _, subdomain := range token.Subdomains {
-			trimmedSubdomain := trimString(subdomain)
-			if trimmedSubdomain != "" && !subdomainFormat.MatchString(trimmedSubdomain) {
+		granted := token.Servers
+		if len(granted) == 0 {
+			granted = []ServerAllocation{{Server: trimString(token.Server), Subdomains: token.Subdomains}}
+		}
+		for _, allocation := range granted {
+			for _, subdomain := range allocation.Subdomains {
+				trimmedSubdomain := trimString(subdomain)
+				if trimmedSubdomain == "" {
+					continue
+				}
+				if c.isReservedSubdomain(trimmedSubdomain) {
+					response.Success = false
+					response.Code = SubdomainsReservedError
+					response.Message = fmt.Sprintf("operate failed, subdomain [%s] is reserved", trimmedSubdomain)
+					log.Printf(response.Message)
+					return response
+				}
+				if owner, taken := c.findSubdomainOwner(token.User, trimString(allocation.Server), trimmedSubdomain); taken {
+					response.Success = false
+					response.Code = SubdomainsConflictError
+					response.Message = fmt.Sprintf("operate failed, subdomain [%s] is already owned by user [%s]", trimmedSubdomain, owner)
+					log.Printf(response.Message)
+					return response
+				}
+			}
+		}
+	}
+
+	if validateServers {
+		servers := make(map[string]bool)
+		for _, allocation := range token.Servers {
+			name := trimString(allocation.Server)
+			if name == "" || servers[name] {
 				response.Success = false
-				response.Code = SubdomainsFormatError
-				response.Message = fmt.Sprintf("operate failed, subdomains [%v] format error", token.Subdomains)
+				response.Code = ServersFormatError
+				response.Message = fmt.Sprintf("operate failed, server [%s] is empty or assigned twice", name)
 				log.Printf(response.Message)
 				return response
 			}
+			servers[name] = true
 		}
 	}
 
@@ -176,17 +258,104 @@ func (c *HandleController) verifyToken(token UserTokenInfo, operate int) Operati
 		return response
 	}
 
+	if validateSchedule && token.Schedule != nil {
+		if err := token.Schedule.validate(); err != nil {
+			response.Success = false
+			response.Code = ScheduleFormatError
+			response.Message = fmt.Sprintf("operate failed, schedule format error: %v", err)
+			log.Printf(response.Message)
+			return response
+		}
+	}
+
+	if validatePolicy {
+		for _, limit := range []string{token.BandwidthUpload, token.BandwidthDownload} {
+			if trimmed := trimString(limit); trimmed != "" && !bandwidthFormat.MatchString(trimmed) {
+				response.Success = false
+				response.Code = BandwidthFormatError
+				response.Message = fmt.Sprintf("operate failed, bandwidth [%s] format error", limit)
+				log.Printf(response.Message)
+				return response
+			}
+		}
+		// frps 对代理的上下行只有一个限速, 不同的上下行档位无法分别生效
+		if !sameBandwidth(token.BandwidthUpload, token.BandwidthDownload) {
+			response.Success = false
+			response.Code = BandwidthFormatError
+			response.Message = fmt.Sprintf("operate failed, upload [%s] and download [%s] bandwidth must be equal, frps applies one limit to both directions", token.BandwidthUpload, token.BandwidthDownload)
+			log.Printf(response.Message)
+			return response
+		}
+	}
+
+	if validatePolicy {
+		if quota := trimString(token.Quota); quota != "" && !quotaFormat.MatchString(quota) {
+			response.Success = false
+			response.Code = QuotaFormatError
+			response.Message = fmt.Sprintf("operate failed, quota [%s] format error", token.Quota)
+			log.Printf(response.Message)
+			return response
+		}
+		if token.SubdomainClaimLimit != nil && *token.SubdomainClaimLimit < 0 {
+			response.Success = false
+			response.Code = SubdomainClaimLimitError
+			response.Message = fmt.Sprintf("operate failed, subdomain claim limit [%d] can not be negative", *token.SubdomainClaimLimit)
+			log.Printf(response.Message)
+			return response
+		}
+		// 0 表示未设置, 每月 1 日重置
+		if token.QuotaResetDay < 0 || token.QuotaResetDay > 28 {
+			response.Success = false
+			response.Code = QuotaFormatError
+			response.Message = fmt.Sprintf("operate failed, quota reset day [%d] out of range 1-28 (0 resets on the 1st)", token.QuotaResetDay)
+			log.Printf(response.Message)
+			return response
+		}
+	}
+
+	if validatePolicy && token.Policy != nil {
+		if limit := trimString(token.Policy.BandwidthLimit); limit != "" && !bandwidthFormat.MatchString(limit) {
+			response.Success = false
+			response.Code = PolicyFormatError
+			response.Message = fmt.Sprintf("operate failed, bandwidth limit [%s] format error", token.Policy.BandwidthLimit)
+			log.Printf(response.Message)
+			return response
+		}
+	}
+
 	return response
 }
 
+// proxyOwnedBy 判断代理是否属于用户, 优先使用 frps 返回的 user 字段, 否则匹配 "<用户名>." 前缀
+func proxyOwnedBy(proxyName string, proxyUser string, user string) bool {
+	if proxyUser != "" {
+		return proxyUser == user
+	}
+	return strings.HasPrefix(proxyName, user+".")
+}
+
+// proxyOwner 返回代理所属的用户, frps 未返回 user 字段时取代理名称中 "." 之前的部分
+func proxyOwner(proxyName string, proxyUser string) string {
+	if proxyUser != "" {
+		return proxyUser
+	}
+	if user, _, found := strings.Cut(proxyName, "."); found {
+		return user
+	}
+	return ""
+}
+
 func cleanPorts(ports []any) []any {
 	cleanedPorts := make([]any, len(ports))
 	for i, port := range ports {
-		if str, ok := port.(string); ok {
-			cleanedPorts[i] = cleanString(str)
-		} else {
+		switch v := port.(type) {
+		case string:
+			cleanedPorts[i] = cleanString(v)
+		case float64:
 			//float64, for JSON numbers
-			cleanedPorts[i] = int(port.(float64))
+			cleanedPorts[i] = int(v)
+		default:
+			cleanedPorts[i] = v
 		}
 	}
 	return cleanedPorts
@@ -212,3 +381,19 @@ func stringContains(element string, data []string) bool {
 	}
 	return false
 }
+
+const randomCharacters = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+// randomString 生成 n 个字母和数字组成的随机字符串
+func randomString(n int) (string, error) {
+	buf := make([]byte, n)
+	max := big.NewInt(int64(len(randomCharacters)))
+	for i := range buf {
+		v, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		buf[i] = randomCharacters[v.Int64()]
+	}
+	return string(buf), nil
+}
@@ -2,6 +2,7 @@ package controller
 
 import (
 	"encoding/json"
+	"frps-panel/pkg/frpsclient"
 	"frps-panel/pkg/server/model"
 	"regexp"
 )
@@ -20,6 +21,15 @@ const (
 	SubdomainsFormatError
 	ExpireDateFormatError // 新增到期时间格式错误
 	FrpServerError
+	ScheduleFormatError
+	ServersFormatError
+	DomainsConflictError
+	SubdomainsReservedError
+	SubdomainsConflictError
+	SubdomainClaimLimitError
+	PolicyFormatError
+	BandwidthFormatError
+	QuotaFormatError
 )
 
 const (
@@ -38,6 +48,7 @@ const (
 	LogoutUrl        = "/logout"
 	LogoutSuccessUrl = "/login"
 	UserDashboardUrl = "/user/dashboard" // 新增普通用户仪表板URL
+	HandlerUrl       = "/handler"
 )
 
 const (
@@ -53,8 +64,11 @@ var (
 	portsFormatSingle = regexp.MustCompile("^\\s*\\d{1,5}\\s*$")
 	portsFormatRange  = regexp.MustCompile("^\\s*\\d{1,5}\\s*-\\s*\\d{1,5}\\s*$")
 	domainFormat      = regexp.MustCompile("^([a-zA-Z0-9]+(-[a-zA-Z0-9]+)*\\.)+[a-zA-Z]{2,}$")
-	subdomainFormat   = regexp.MustCompile("^[a-zA-z0-9-]{1,20}$")
+	subdomainFormat   = regexp.MustCompile("^[a-zA-Z0-9][a-zA-Z0-9-]{0,19}$")
 	expireDateFormat  = regexp.MustCompile("^\\d{4}-\\d{2}-\\d{2} \\d{2}:\\d{2}:\\d{2}$") // 新增到期时间格式
+	scheduleFormat    = regexp.MustCompile("^([01]\\d|2[0-3]):[0-5]\\d$")
+	bandwidthFormat   = regexp.MustCompile("^\\d+(\\.\\d+)?(KB|MB)$")
+	quotaFormat       = regexp.MustCompile("^\\d+(\\.\\d+)?(MB|GB|TB)$")
 	trimAllSpace      = regexp.MustCompile("[\\n\\t\\r\\s]")
 )
 
@@ -87,6 +101,24 @@ type CommonInfo struct {
 	TlsMode       bool   `toml:"tls_mode"`
 	TlsCertFile   string `toml:"tls_cert_file"`
 	TlsKeyFile    string `toml:"tls_key_file"`
+
+	ReservedSubdomains  []string `toml:"reserved_subdomains"`
+	SubdomainClaimLimit int      `toml:"subdomain_claim_limit"`
+	UserCacheTTL        int      `toml:"user_cache_ttl"`
+	PluginIPFallback    bool     `toml:"plugin_ip_fallback"`
+
+	PluginLogAccepts       bool `toml:"plugin_log_accepts"`
+	PluginLogRetentionDays int  `toml:"plugin_log_retention_days"`
+	PluginLogMaxRows       int  `toml:"plugin_log_max_rows"`
+
+	TrafficCollectInterval int `toml:"traffic_collect_interval"`
+	HealthCheckInterval    int `toml:"health_check_interval"`
+
+	SecretKey string `toml:"secret_key"`
+
+	DashboardProxyAllow []string `toml:"dashboard_proxy_allow"`
+
+	TokenRotationGrace int `toml:"token_rotation_grace"`
 }
 
 type ServerInfo struct {
@@ -94,21 +126,116 @@ type ServerInfo struct {
 	DashboardAddr string `toml:"dashboard_addr" json:"dashboard_addr"`
 	DashboardPort int    `toml:"dashboard_port" json:"dashboard_port"`
 	DashboardUser string `toml:"dashboard_user" json:"dashboard_user"`
-	DashboardPwd  string `toml:"dashboard_pwd" json:"dashboard_pwd"`
+	DashboardPwd  string `toml:"dashboard_pwd" json:"-"`
 	DashboardTls  bool   `json:"dashboard_tls"`
+	PluginKey     string `json:"plugin_key"`
+
+	DashboardCaCert      string `json:"dashboard_ca_cert"`
+	DashboardFingerprint string `json:"dashboard_fingerprint"`
+	DashboardClientCert  string `json:"dashboard_client_cert"`
+	DashboardClientKey   string `json:"-"`
+	DashboardInsecure    bool   `json:"dashboard_insecure"`
+	TlsVerify            string `json:"tls_verify" gorm:"-"`
+
+	// 凭据不返回给页面, 只标记是否已设置
+	DashboardPwdSet       bool `json:"dashboard_pwd_set" gorm:"-"`
+	DashboardClientKeySet bool `json:"dashboard_client_key_set" gorm:"-"`
+}
+
+// clientConfig 返回访问该服务器 dashboard 的客户端配置, 其中的凭据可能是加密的, 需要通过 serverClients 解密
+func (s ServerInfo) clientConfig() frpsclient.Config {
+	return frpsclient.Config{
+		Name:     s.Name,
+		Addr:     s.DashboardAddr,
+		Port:     s.DashboardPort,
+		User:     s.DashboardUser,
+		Password: s.DashboardPwd,
+		TLS:      s.DashboardTls,
+
+		CACert:      s.DashboardCaCert,
+		Fingerprint: s.DashboardFingerprint,
+		ClientCert:  s.DashboardClientCert,
+		ClientKey:   s.DashboardClientKey,
+		Insecure:    s.DashboardInsecure,
+	}
+}
+
+// tlsVerifyMode 返回 dashboard 证书的校验方式, 供页面提示
+func (s ServerInfo) tlsVerifyMode() string {
+	switch {
+	case !s.DashboardTls:
+		return "none"
+	case trimString(s.DashboardFingerprint) != "":
+		return "pinned"
+	case s.DashboardInsecure:
+		return "insecure"
+	case trimString(s.DashboardCaCert) != "":
+		return "ca"
+	default:
+		return "system"
+	}
+}
+
+// AccessSchedule limits the weekly time window in which a user may tunnel.
+// Days uses time.Weekday numbering (0 is Sunday), an empty list means every day.
+// A window whose To is not after From wraps past midnight into the next day.
+type AccessSchedule struct {
+	Days     []int  `json:"days"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Timezone string `json:"timezone"`
+}
+
+// ProxyPolicy rewrites the proxies a user creates before frps accepts them.
+// BandwidthLimit uses the frp format, e.g. 512KB or 1MB, empty means no limit.
+type ProxyPolicy struct {
+	ForceEncryption  bool   `json:"force_encryption"`
+	ForceCompression bool   `json:"force_compression"`
+	BandwidthLimit   string `json:"bandwidth_limit"`
+	PrefixProxyName  bool   `json:"prefix_proxy_name"`
+	PinRemotePort    bool   `json:"pin_remote_port"`
+}
+
+// ServerAllocation is the ports, domains and subdomains a user may use on one server
+type ServerAllocation struct {
+	Server     string   `json:"server"`
+	Ports      []any    `json:"ports"`
+	Domains    []string `json:"domains"`
+	Subdomains []string `json:"subdomains"`
 }
 
 type UserTokenInfo struct {
-	User       string   `json:"user" form:"user"`
-	Token      string   `json:"token" form:"token"`
-	Comment    string   `json:"comment" form:"comment"`
-	Ports      []any    `json:"ports" form:"ports"`
-	Domains    []string `json:"domains" form:"domains"`
-	Subdomains []string `json:"subdomains" form:"subdomains"`
-	Enable     bool     `json:"enable" form:"enable"`
-	Server     string   `json:"server" form:"server"`
-	CreateDate string   `json:"create_date" form:"create_date"`
-	ExpireDate string   `json:"expire_date" form:"expire_date"`
+	User       string             `json:"user" form:"user"`
+	Token      string             `json:"token" form:"token"`
+	Comment    string             `json:"comment" form:"comment"`
+	Ports      []any              `json:"ports" form:"ports"`
+	Domains    []string           `json:"domains" form:"domains"`
+	Subdomains []string           `json:"subdomains" form:"subdomains"`
+	Schedule   *AccessSchedule    `json:"schedule" form:"-"`
+	Policy     *ProxyPolicy       `json:"policy" form:"-"`
+	Enable     bool               `json:"enable" form:"enable"`
+	Server     string             `json:"server" form:"server"`
+	Servers    []ServerAllocation `json:"servers" form:"-"`
+	CreateDate string             `json:"create_date" form:"create_date"`
+	ExpireDate string             `json:"expire_date" form:"expire_date"`
+
+	// 上传/下载带宽档位, frps 对单个代理的两个方向共用一个限速, 两者必须相同或都为空
+	BandwidthUpload   string `json:"bandwidth_upload" form:"bandwidth_upload"`
+	BandwidthDownload string `json:"bandwidth_download" form:"bandwidth_download"`
+
+	// 每月流量配额, 已用流量和充值由面板维护, 修改用户时不会覆盖
+	Quota         string `json:"quota" form:"quota"`
+	QuotaResetDay int    `json:"quota_reset_day" form:"quota_reset_day"`
+	QuotaUsed     int64  `json:"quota_used" form:"-"`
+	QuotaTopUp    int64  `json:"quota_top_up" form:"-"`
+	QuotaCycle    string `json:"quota_cycle" form:"-"`
+
+	// 可自助申请的子域名数, 为空时使用 subdomain_claim_limit
+	SubdomainClaimLimit *int `json:"subdomain_claim_limit" form:"-"`
+
+	// 用户自助更换 token 后旧 token 在宽限期内仍可用于 frpc, 旧 token 不返回给前端
+	PreviousToken      string `json:"-" form:"-"`
+	PreviousTokenUntil int64  `json:"previous_token_until" form:"-"`
 }
 
 type TokenResponse struct {
@@ -122,6 +249,8 @@ type OperationResponse struct {
 	Success bool   `json:"success"`
 	Code    int    `json:"code"`
 	Message string `json:"message"`
+	// 操作成功但需要管理员处理的问题
+	Warnings []string `json:"warnings,omitempty"`
 }
 
 type ProxyResponse struct {
@@ -129,6 +258,21 @@ type ProxyResponse struct {
 	Data string `json:"data"`
 }
 
+// DashboardSave 是保存服务器 dashboard 设置的请求, 凭据为 nil 时保持不变
+type DashboardSave struct {
+	Name                 string  `json:"name"`
+	DashboardAddr        string  `json:"dashboard_addr"`
+	DashboardPort        int     `json:"dashboard_port"`
+	DashboardUser        string  `json:"dashboard_user"`
+	DashboardPwd         *string `json:"dashboard_pwd"`
+	DashboardTls         bool    `json:"dashboard_tls"`
+	DashboardCaCert      string  `json:"dashboard_ca_cert"`
+	DashboardFingerprint string  `json:"dashboard_fingerprint"`
+	DashboardClientCert  string  `json:"dashboard_client_cert"`
+	DashboardClientKey   *string `json:"dashboard_client_key"`
+	DashboardInsecure    bool    `json:"dashboard_insecure"`
+}
+
 type TokenSearch struct {
 	UserTokenInfo
 	Page  int `form:"page"`
@@ -165,6 +309,20 @@ func ToUserTokenInfo(userToken model.UserToken) (UserTokenInfo, error) {
 		Server:     userToken.Server,
 		CreateDate: userToken.CreateDate,
 		ExpireDate: userToken.ExpireDate,
+
+		BandwidthUpload:   userToken.BandwidthUpload,
+		BandwidthDownload: userToken.BandwidthDownload,
+
+		Quota:         userToken.Quota,
+		QuotaResetDay: userToken.QuotaResetDay,
+		QuotaUsed:     userToken.QuotaUsed,
+		QuotaTopUp:    userToken.QuotaTopUp,
+		QuotaCycle:    userToken.QuotaCycle,
+
+		SubdomainClaimLimit: userToken.SubdomainClaimLimit,
+
+		PreviousToken:      userToken.PreviousToken,
+		PreviousTokenUntil: userToken.PreviousTokenUntil,
 	}
 	if userToken.Ports != "" {
 		if err := json.Unmarshal([]byte(userToken.Ports), &info.Ports); err != nil {
@@ -181,6 +339,16 @@ func ToUserTokenInfo(userToken model.UserToken) (UserTokenInfo, error) {
 			return info, err
 		}
 	}
+	if userToken.Schedule != "" {
+		if err := json.Unmarshal([]byte(userToken.Schedule), &info.Schedule); err != nil {
+			return info, err
+		}
+	}
+	if userToken.Policy != "" {
+		if err := json.Unmarshal([]byte(userToken.Policy), &info.Policy); err != nil {
+			return info, err
+		}
+	}
 	return info, nil
 }
 
@@ -193,6 +361,20 @@ func FromUserTokenInfo(info UserTokenInfo) (model.UserToken, error) {
 		Server:     info.Server,
 		CreateDate: info.CreateDate,
 		ExpireDate: info.ExpireDate,
+
+		BandwidthUpload:   info.BandwidthUpload,
+		BandwidthDownload: info.BandwidthDownload,
+
+		Quota:         info.Quota,
+		QuotaResetDay: info.QuotaResetDay,
+		QuotaUsed:     info.QuotaUsed,
+		QuotaTopUp:    info.QuotaTopUp,
+		QuotaCycle:    info.QuotaCycle,
+
+		SubdomainClaimLimit: info.SubdomainClaimLimit,
+
+		PreviousToken:      info.PreviousToken,
+		PreviousTokenUntil: info.PreviousTokenUntil,
 	}
 	ports, err := json.Marshal(info.Ports)
 	if err != nil {
@@ -212,5 +394,21 @@ func FromUserTokenInfo(info UserTokenInfo) (model.UserToken, error) {
 	}
 	userToken.Subdomains = string(subdomains)
 
+	if info.Schedule != nil {
+		schedule, err := json.Marshal(info.Schedule)
+		if err != nil {
+			return userToken, err
+		}
+		userToken.Schedule = string(schedule)
+	}
+
+	if info.Policy != nil {
+		policy, err := json.Marshal(info.Policy)
+		if err != nil {
+			return userToken, err
+		}
+		userToken.Policy = string(policy)
+	}
+
 	return userToken, nil
 }
@@ -1,6 +1,9 @@
 package model
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+
 	"gorm.io/gorm"
 )
 
@@ -12,10 +15,70 @@ type UserToken struct {
 	Ports      string `gorm:"type:text"` // Stored as JSON string
 	Domains    string `gorm:"type:text"` // Stored as JSON string
 	Subdomains string `gorm:"type:text"` // Stored as JSON string
+	Schedule   string `gorm:"type:text"` // Stored as JSON string, empty means no restriction
+	Policy     string `gorm:"type:text"` // Stored as JSON string, empty means no rewriting
 	Enable     bool
 	Server     string
 	CreateDate string
 	ExpireDate string
+
+	BandwidthUpload   string // frp bandwidth quantity, e.g. 1MB, empty means unlimited
+	BandwidthDownload string // frp bandwidth quantity, e.g. 1MB, empty means unlimited
+
+	Quota         string // monthly transfer quota, e.g. 100GB, empty means unlimited
+	QuotaResetDay int    // day of month the quota cycle starts, 1-28, 0 means the 1st
+	QuotaUsed     int64  // bytes transferred in the current cycle, kept by the traffic collector
+	QuotaTopUp    int64  // extra bytes granted by an admin for the current cycle
+	QuotaCycle    string // first day of the current cycle, 2006-01-02
+
+	SubdomainClaimLimit *int // subdomains the user may claim from the dashboard, nil uses subdomain_claim_limit
+
+	PreviousToken      string // token replaced by a self-service rotation, still accepted for frpc until PreviousTokenUntil
+	PreviousTokenUntil int64  // unix seconds, 0 means the previous token is no longer accepted
+
+	gorm.Model
+}
+
+// UserServer is the GORM model for the servers a user is assigned to,
+// each with its own port, domain and subdomain allocation
+type UserServer struct {
+	User       string `gorm:"size:191;uniqueIndex:idx_user_server"`
+	Server     string `gorm:"size:191;uniqueIndex:idx_user_server"`
+	Ports      string `gorm:"type:text"` // Stored as JSON string
+	Domains    string `gorm:"type:text"` // Stored as JSON string
+	Subdomains string `gorm:"type:text"` // Stored as JSON string
+	gorm.Model
+}
+
+// SubdomainClaim 普通用户自助申请的子域名
+type SubdomainClaim struct {
+	User      string `gorm:"size:191;index"`
+	Server    string `gorm:"size:191;uniqueIndex:idx_server_subdomain"`
+	Subdomain string `gorm:"size:191;uniqueIndex:idx_server_subdomain"`
+	gorm.Model
+}
+
+// PluginLog records a decision made by the frps plugin handler
+type PluginLog struct {
+	Op         string `gorm:"size:32;index"`
+	User       string `gorm:"size:191;index"`
+	Server     string `gorm:"size:191;index"`
+	ProxyName  string
+	ProxyType  string
+	RunID      string
+	ClientAddr string
+	Reject     bool   `gorm:"index"`
+	Reason     string `gorm:"type:text"`
+	gorm.Model
+}
+
+// AdminAudit records a mutation made from the admin panel
+type AdminAudit struct {
+	Actor    string `gorm:"size:191;index"`
+	Action   string `gorm:"size:64;index"`
+	Target   string `gorm:"size:191;index"`
+	SourceIP string
+	Payload  string `gorm:"type:text"` // Stored as JSON string
 	gorm.Model
 }
 
@@ -27,5 +90,86 @@ type ServerInfo struct {
 	DashboardUser string
 	DashboardPwd  string
 	DashboardTls  bool
+	// frps registers the plugin at /handler/<PluginKey>; NULL until a key is generated, so rows without a key
+	// (inserted outside gorm or before the migration) don't collide on the unique index
+	PluginKey *string `gorm:"size:64;uniqueIndex:idx_server_plugin_key"`
+
+	// TLS verification of the dashboard, certificates and keys are PEM encoded
+	DashboardCaCert      string `gorm:"type:text"`
+	DashboardFingerprint string // SHA-256 of the dashboard certificate
+	DashboardClientCert  string `gorm:"type:text"`
+	DashboardClientKey   string `gorm:"type:text"`
+	DashboardInsecure    bool   // skip verification, only when explicitly enabled
+	gorm.Model
+}
+
+// BeforeCreate gives every new server its own plugin key
+func (s *ServerInfo) BeforeCreate(tx *gorm.DB) error {
+	if s.PluginKey != nil && *s.PluginKey != "" {
+		return nil
+	}
+	key, err := NewPluginKey()
+	if err != nil {
+		return err
+	}
+	s.PluginKey = &key
+	return nil
+}
+
+// NewPluginKey generates a random hex plugin key
+func NewPluginKey() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// ProxyTrafficCursor keeps the last counters seen for a proxy, used to compute traffic deltas
+type ProxyTrafficCursor struct {
+	Server     string `gorm:"size:191;uniqueIndex:idx_cursor_server_proxy"`
+	ProxyName  string `gorm:"size:191;uniqueIndex:idx_cursor_server_proxy"`
+	TrafficIn  int64
+	TrafficOut int64
+	gorm.Model
+}
+
+// TrafficDaily stores the traffic of a proxy per day, Day is formatted as 2006-01-02
+type TrafficDaily struct {
+	Server     string `gorm:"size:191;uniqueIndex:idx_daily_server_proxy_day"`
+	ProxyName  string `gorm:"size:191;uniqueIndex:idx_daily_server_proxy_day"`
+	Day        string `gorm:"size:10;uniqueIndex:idx_daily_server_proxy_day;index"`
+	User       string `gorm:"size:191;index"`
+	ProxyType  string
+	TrafficIn  int64
+	TrafficOut int64
+	gorm.Model
+}
+
+// ServerProbe is one health check of a frps dashboard, kept for the uptime history
+type ServerProbe struct {
+	Server    string `gorm:"size:191;index"`
+	Up        bool
+	LatencyMs int64
+	Error     string `gorm:"type:text"`
+	gorm.Model
+}
+
+// ServerStatusEvent records a frps server going up or down
+type ServerStatusEvent struct {
+	Server string `gorm:"size:191;index"`
+	Up     bool
+	Error  string `gorm:"type:text"`
+	gorm.Model
+}
+
+// ConfigTemplate is one version of a frpc config template, Server is empty for the default template.
+// An empty Template on a server override means the server uses the default template again
+type ConfigTemplate struct {
+	Server   string `gorm:"size:191;uniqueIndex:idx_template_server_version"`
+	Version  int    `gorm:"uniqueIndex:idx_template_server_version"`
+	Template string `gorm:"type:text"`
+	Author   string `gorm:"size:191"`
+	Comment  string
 	gorm.Model
 }